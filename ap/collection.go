@@ -0,0 +1,149 @@
+package ap
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const collectionPageSize = 40
+
+// Followers returns the followers collection of an actor, or its page when page > 0.
+func (s *Service) Followers(ctx context.Context, id string, page int) (any, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.Followers")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	total, err := s.store.CountFollowers(ctx, entity.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	collection := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID + "/followers"
+	hidden := s.hideNetwork(ctx, entity)
+	if page <= 0 || hidden {
+		return collectionIndex(collection, total, hidden), nil
+	}
+
+	followers, err := s.store.GetFollowersPage(ctx, entity.ID, (page-1)*collectionPageSize, collectionPageSize)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	items := make([]string, 0, len(followers))
+	for _, follower := range followers {
+		items = append(items, follower.SubscriberPersonURL)
+	}
+
+	return collectionPage(collection, total, page, items), nil
+}
+
+// Following returns the following collection of an actor, or its page when page > 0.
+func (s *Service) Following(ctx context.Context, id string, page int) (any, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.Following")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	total, err := s.store.CountFollows(ctx, entity.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	collection := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID + "/following"
+	hidden := s.hideNetwork(ctx, entity)
+	if page <= 0 || hidden {
+		return collectionIndex(collection, total, hidden), nil
+	}
+
+	follows, err := s.store.GetFollowsPage(ctx, entity.ID, (page-1)*collectionPageSize, collectionPageSize)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	items := make([]string, 0, len(follows))
+	for _, follow := range follows {
+		items = append(items, follow.PublisherPersonURL)
+	}
+
+	return collectionPage(collection, total, page, items), nil
+}
+
+// hideNetwork reports whether the owner of the entity chose to publish only the counts.
+func (s *Service) hideNetwork(ctx context.Context, entity types.ApEntity) bool {
+	if entity.CCID == "" {
+		return false
+	}
+
+	// settings are optional
+	settings, _ := s.store.GetUserSettings(ctx, entity.CCID)
+	return settings.HideNetwork
+}
+
+// collectionIndex returns the collection itself; the first page is omitted when the lists are hidden.
+func collectionIndex(collection string, total int64, hidden bool) types.Collection {
+	index := types.Collection{
+		Context:    "https://www.w3.org/ns/activitystreams",
+		ID:         collection,
+		Type:       "OrderedCollection",
+		TotalItems: total,
+	}
+	if !hidden {
+		index.First = collection + "?page=1"
+	}
+	return index
+}
+
+func collectionPage(collection string, total int64, page int, items []string) types.CollectionPage {
+	result := types.CollectionPage{
+		Context:      "https://www.w3.org/ns/activitystreams",
+		ID:           collection + "?page=" + strconv.Itoa(page),
+		Type:         "OrderedCollectionPage",
+		TotalItems:   total,
+		PartOf:       collection,
+		OrderedItems: items,
+	}
+	if int64(page*collectionPageSize) < total {
+		result.Next = collection + "?page=" + strconv.Itoa(page+1)
+	}
+	if page > 1 {
+		result.Prev = collection + "?page=" + strconv.Itoa(page-1)
+	}
+	return result
+}
+
+// Featured returns the pinned posts of an actor.
+func (s *Service) Featured(ctx context.Context, id string) (types.ObjectCollection, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.Featured")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return types.ObjectCollection{}, err
+	}
+
+	notes := s.bridge.FeaturedNotes(ctx, entity)
+
+	return types.ObjectCollection{
+		Context:      "https://www.w3.org/ns/activitystreams",
+		ID:           "https://" + s.config.FQDN + "/ap/acct/" + entity.ID + "/collections/featured",
+		Type:         "OrderedCollection",
+		TotalItems:   len(notes),
+		OrderedItems: notes,
+	}, nil
+}
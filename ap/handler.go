@@ -2,15 +2,18 @@ package ap
 
 import (
 	"bytes"
+	"errors"
 	"io"
 	"log"
 	"net/http"
 	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/labstack/echo/v4"
 	"go.opentelemetry.io/otel"
 
+	"github.com/concrnt/ccworld-ap-bridge/middleware"
 	"github.com/concrnt/ccworld-ap-bridge/types"
 )
 
@@ -174,10 +177,18 @@ func (h Handler) Inbox(c echo.Context) error {
 
 	id := c.Param("id")
 
-	result, err := h.service.Inbox(ctx, object, id, c.Request())
+	result, err := h.service.Inbox(ctx, object, bodyBytes, id, c.Request())
 	if err != nil {
 		span.RecordError(err)
 		log.Printf("api/handler/inbox %v", err)
+		var verr *VerificationError
+		if errors.As(err, &verr) {
+			return c.String(http.StatusUnauthorized, "Request verification failed: "+verr.Reason)
+		}
+		var throttled *middleware.ThrottledError
+		if errors.As(err, &throttled) {
+			return middleware.Throttle(c, throttled)
+		}
 		return c.String(http.StatusOK, "Internal server error: "+err.Error()) // 再送されても基本同じなので200
 	}
 
@@ -185,6 +196,67 @@ func (h Handler) Inbox(c echo.Context) error {
 	return c.JSON(http.StatusOK, result)
 }
 
+func (h Handler) Followers(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Followers")
+	defer span.End()
+
+	id := c.Param("id")
+	if id == "" {
+		return c.String(http.StatusBadRequest, "Invalid username")
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+
+	result, err := h.service.Followers(ctx, id, page)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	c.Response().Header().Set("Content-Type", "application/activity+json")
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h Handler) Following(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Following")
+	defer span.End()
+
+	id := c.Param("id")
+	if id == "" {
+		return c.String(http.StatusBadRequest, "Invalid username")
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+
+	result, err := h.service.Following(ctx, id, page)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	c.Response().Header().Set("Content-Type", "application/activity+json")
+	return c.JSON(http.StatusOK, result)
+}
+
+func (h Handler) Featured(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Featured")
+	defer span.End()
+
+	id := c.Param("id")
+	if id == "" {
+		return c.String(http.StatusBadRequest, "Invalid username")
+	}
+
+	result, err := h.service.Featured(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	c.Response().Header().Set("Content-Type", "application/activity+json")
+	return c.JSON(http.StatusOK, result)
+}
+
 func (h Handler) Outbox(c echo.Context) error {
 	ctx, span := tracer.Start(c.Request().Context(), "Outbox")
 	defer span.End()
@@ -194,8 +266,21 @@ func (h Handler) Outbox(c echo.Context) error {
 		return c.String(http.StatusBadRequest, "Invalid username")
 	}
 
-	result := h.service.OutboxIndex(ctx, id)
-
 	c.Response().Header().Set("Content-Type", "application/activity+json")
+
+	if c.QueryParam("page") != "true" {
+		result, err := h.service.OutboxIndex(ctx, id)
+		if err != nil {
+			span.RecordError(err)
+			return c.String(http.StatusNotFound, "entity not found")
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+
+	result, err := h.service.OutboxPage(ctx, id, c.QueryParam("max_id"), c.QueryParam("min_id"))
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
 	return c.JSON(http.StatusOK, result)
 }
@@ -0,0 +1,368 @@
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+
+	"github.com/concrnt/ccworld-ap-bridge/bridge"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+)
+
+// outboxClient reads timelines from the Concrnt API for the outbox.
+var outboxClient = &http.Client{Timeout: 10 * time.Second}
+
+const (
+	outboxPageSize = 20
+
+	// how many chunks a single page may walk through
+	outboxMaxChunkScans = 16
+)
+
+/*
+https://don-dev.luhrck.com/users/totegamma/outbox
+{
+  "@context": "https://www.w3.org/ns/activitystreams",
+  "id": "https://don-dev.luhrck.com/users/totegamma/outbox",
+  "type": "OrderedCollection",
+  "totalItems": 60,
+  "first": "https://don-dev.luhrck.com/users/totegamma/outbox?page=true",
+  "last": "https://don-dev.luhrck.com/users/totegamma/outbox?min_id=0&page=true"
+}
+*/
+
+/*
+https://don-dev.luhrck.com/users/totegamma/outbox?page=true
+{
+  "@context": [
+    "https://www.w3.org/ns/activitystreams",
+    {
+      "ostatus": "http://ostatus.org#",
+      "atomUri": "ostatus:atomUri",
+      "inReplyToAtomUri": "ostatus:inReplyToAtomUri",
+      "conversation": "ostatus:conversation",
+      "sensitive": "as:sensitive",
+      "toot": "http://joinmastodon.org/ns#",
+      "votersCount": "toot:votersCount",
+      "Hashtag": "as:Hashtag"
+    }
+  ],
+  "id": "https://don-dev.luhrck.com/users/totegamma/outbox?page=true",
+  "type": "OrderedCollectionPage",
+  "next": "https://don-dev.luhrck.com/users/totegamma/outbox?max_id=113912980868238695&page=true",
+  "prev": "https://don-dev.luhrck.com/users/totegamma/outbox?min_id=114543856390108463&page=true",
+  "partOf": "https://don-dev.luhrck.com/users/totegamma/outbox",
+  "orderedItems": [
+    {
+      "id": "https://don-dev.luhrck.com/users/totegamma/statuses/114543856390108463/activity",
+      "type": "Create",
+      "actor": "https://don-dev.luhrck.com/users/totegamma",
+      "published": "2025-05-21T04:09:03Z",
+      "to": [
+        "https://www.w3.org/ns/activitystreams#Public"
+      ],
+      "cc": [
+        "https://don-dev.luhrck.com/users/totegamma/followers"
+      ],
+      "object": {
+*/
+
+// OutboxIndex returns the outbox collection of an actor.
+func (s *Service) OutboxIndex(ctx context.Context, id string) (types.OutboxIndex, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.OutboxIndex")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return types.OutboxIndex{}, err
+	}
+
+	outbox := "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox"
+	index := types.OutboxIndex{
+		Context: "https://www.w3.org/ns/activitystreams",
+		ID:      outbox,
+		Type:    "OrderedCollection",
+		First:   outbox + "?page=true",
+		Last:    outbox + "?min_id=0&page=true",
+	}
+
+	// the count covers the notes the bridge has delivered, which is what remote servers have seen
+	if entity.TimelineID == "" {
+		total, err := s.store.CountPublicSentNotes(ctx, entity.ID)
+		if err != nil {
+			span.RecordError(err)
+			return types.OutboxIndex{}, err
+		}
+		totalItems := int(total)
+		index.TotalItems = &totalItems
+	}
+
+	return index, nil
+}
+
+// OutboxPage returns a page of the outbox of an actor.
+// maxID and minID are cursors in unix milliseconds; items strictly older than maxID
+// or strictly newer than minID are returned, newest first.
+func (s *Service) OutboxPage(ctx context.Context, id, maxID, minID string) (types.OutboxItems, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.OutboxPage")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return types.OutboxItems{}, err
+	}
+
+	var maxTime, minTime time.Time
+	if maxID != "" {
+		maxTime, err = parseOutboxCursor(maxID)
+		if err != nil {
+			return types.OutboxItems{}, errors.Wrap(err, "invalid max_id")
+		}
+	}
+	if minID != "" {
+		minTime, err = parseOutboxCursor(minID)
+		if err != nil {
+			return types.OutboxItems{}, errors.Wrap(err, "invalid min_id")
+		}
+	}
+
+	timeline, err := s.outboxTimeline(ctx, entity)
+	if err != nil {
+		span.RecordError(err)
+		return types.OutboxItems{}, err
+	}
+
+	items, err := s.outboxItems(ctx, timeline, maxTime, minTime)
+	if err != nil {
+		span.RecordError(err)
+		return types.OutboxItems{}, err
+	}
+
+	outbox := "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox"
+	pageID := outbox + "?page=true"
+	if maxID != "" {
+		pageID = outbox + "?max_id=" + maxID + "&page=true"
+	} else if minID != "" {
+		pageID = outbox + "?min_id=" + minID + "&page=true"
+	}
+
+	page := types.OutboxItems{
+		Context:      "https://www.w3.org/ns/activitystreams",
+		ID:           pageID,
+		Type:         "OrderedCollectionPage",
+		PartOf:       outbox,
+		OrderedItems: []types.ApObject{},
+	}
+
+	if len(items) == 0 {
+		return page, nil
+	}
+
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+	for _, item := range items {
+		if !strings.HasPrefix(item.ResourceID, "m") {
+			continue
+		}
+
+		if entity.TimelineID != "" {
+			announce, err := s.bridge.GroupAnnounce(ctx, entity, item.ResourceID, item.CDate)
+			if err != nil {
+				continue
+			}
+			announce.Context = nil
+			page.OrderedItems = append(page.OrderedItems, announce)
+			continue
+		}
+
+		note, err := s.bridge.MessageToNote(ctx, item.ResourceID)
+		if err != nil {
+			continue
+		}
+
+		// the home timeline also carries posts of the user's other actors
+		attributedTo := note.AttributedTo
+		if attributedTo == "" {
+			attributedTo = note.Actor
+		}
+		if attributedTo != actor || !bridge.Fetchable(note) {
+			continue
+		}
+
+		activity := s.bridge.NoteToActivity(item.ResourceID, note, entity.ID)
+		activity.Context = nil
+		page.OrderedItems = append(page.OrderedItems, activity)
+	}
+
+	page.Next = outbox + "?max_id=" + outboxCursor(items[len(items)-1].CDate) + "&page=true"
+	page.Prev = outbox + "?min_id=" + outboxCursor(items[0].CDate) + "&page=true"
+
+	return page, nil
+}
+
+// outboxTimeline returns the fully qualified timeline the outbox of the entity is built from.
+func (s *Service) outboxTimeline(ctx context.Context, entity types.ApEntity) (string, error) {
+	if entity.TimelineID != "" {
+		return entity.TimelineID + "@" + s.config.FQDN, nil
+	}
+
+	ccid := entity.CCID
+	if ccid == "" {
+		return "", errors.New("entity has no timeline")
+	}
+
+	timeline, err := s.client.GetTimeline(ctx, world.UserHomeStream+"@"+ccid, &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		return "", errors.Wrap(err, "GetTimeline")
+	}
+
+	return timeline.ID + "@" + s.config.FQDN, nil
+}
+
+// outboxItems returns a page of the timeline, sorted newest first.
+// Without minTime it is the newest page older than maxTime (now if zero),
+// with minTime the page right after minTime.
+func (s *Service) outboxItems(ctx context.Context, timeline string, maxTime, minTime time.Time) ([]core.TimelineItem, error) {
+	if !minTime.IsZero() {
+		return s.outboxItemsSince(ctx, timeline, minTime)
+	}
+
+	queryTime := maxTime
+	if queryTime.IsZero() {
+		queryTime = time.Now()
+	}
+
+	seen := make(map[string]bool)
+	collected := []core.TimelineItem{}
+
+	for i := 0; i < outboxMaxChunkScans; i++ {
+		// items strictly older than queryTime; on a chunk boundary that is the previous chunk
+		chunks, err := s.client.GetChunks(ctx, s.config.FQDN, []string{timeline}, queryTime.Add(-time.Nanosecond), &client.Options{Resolver: s.config.FQDN})
+		if err != nil {
+			return nil, errors.Wrap(err, "GetChunks")
+		}
+
+		chunk, ok := chunks[timeline]
+		if !ok || len(chunk.Items) == 0 {
+			break
+		}
+
+		next := queryTime
+		for _, item := range chunk.Items {
+			if !item.CDate.Before(queryTime) {
+				continue
+			}
+			if item.CDate.Before(next) {
+				next = item.CDate
+			}
+			if seen[item.ResourceID] {
+				continue
+			}
+			seen[item.ResourceID] = true
+			collected = append(collected, item)
+		}
+
+		// continue below the chunk once everything in it has been read
+		if epoch, err := strconv.ParseInt(chunk.Epoch, 10, 64); err == nil {
+			if start := time.Unix(epoch, 0); start.Before(next) {
+				next = start
+			}
+		}
+
+		if !next.Before(queryTime) {
+			break
+		}
+		if len(collected) >= outboxPageSize {
+			break
+		}
+		queryTime = next
+	}
+
+	sort.Slice(collected, func(i, j int) bool {
+		return collected[i].CDate.After(collected[j].CDate)
+	})
+
+	if len(collected) > outboxPageSize {
+		collected = collected[:outboxPageSize]
+	}
+
+	return collected, nil
+}
+
+// outboxItemsSince reads the timeline forward from minTime, so that the page right after minTime
+// is found no matter how much was posted since. Items are sorted newest first.
+func (s *Service) outboxItemsSince(ctx context.Context, timeline string, minTime time.Time) ([]core.TimelineItem, error) {
+	// since has a resolution of seconds; leave room for the items of minTime's own second
+	query := url.Values{}
+	query.Set("timelines", timeline)
+	query.Set("since", strconv.FormatInt(minTime.Unix(), 10))
+	query.Set("limit", strconv.Itoa(outboxPageSize*2))
+
+	req, err := http.NewRequestWithContext(ctx, "GET", "https://"+s.config.FQDN+"/api/v1/timelines/range?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := outboxClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRange")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GetRange: %s", resp.Status)
+	}
+
+	var result struct {
+		Content []core.TimelineItem `json:"content"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&result)
+	if err != nil {
+		return nil, errors.Wrap(err, "GetRange")
+	}
+
+	items := []core.TimelineItem{}
+	for _, item := range result.Content {
+		if item.CDate.After(minTime) {
+			items = append(items, item)
+		}
+	}
+
+	// the oldest items right after minTime make up the page
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CDate.Before(items[j].CDate)
+	})
+	if len(items) > outboxPageSize {
+		items = items[:outboxPageSize]
+	}
+	slices.Reverse(items)
+
+	return items, nil
+}
+
+func outboxCursor(t time.Time) string {
+	return strconv.FormatInt(t.UnixMilli(), 10)
+}
+
+func parseOutboxCursor(cursor string) (time.Time, error) {
+	ms, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
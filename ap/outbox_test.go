@@ -0,0 +1,208 @@
+package ap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const (
+	testTimeline   = "t0000000000000000000000000@example.com"
+	testChunkWidth = 600 // seconds, as on Concrnt
+)
+
+// chunkClient serves GetChunks from items bucketed into epochs like a Concrnt timeline.
+type chunkClient struct {
+	client.Client
+	items []core.TimelineItem
+}
+
+func (c chunkClient) GetChunks(ctx context.Context, domain string, timelines []string, queryTime time.Time, opts *client.Options) (map[string]core.Chunk, error) {
+	// the chunk of queryTime, or the newest non-empty chunk before it
+	epoch := queryTime.Unix() / testChunkWidth * testChunkWidth
+	for ; epoch >= 0; epoch -= testChunkWidth {
+		chunk := core.Chunk{Key: timelines[0], Epoch: strconv.FormatInt(epoch, 10)}
+		for _, item := range c.items {
+			if item.CDate.Unix()/testChunkWidth*testChunkWidth == epoch {
+				chunk.Items = append(chunk.Items, item)
+			}
+		}
+		if len(chunk.Items) > 0 {
+			return map[string]core.Chunk{timelines[0]: chunk}, nil
+		}
+		if c.items[len(c.items)-1].CDate.Unix() > epoch {
+			break
+		}
+	}
+	return map[string]core.Chunk{}, nil
+}
+
+// testItems returns n items a step apart, newest first.
+func testItems(n int, newest time.Time, step time.Duration) []core.TimelineItem {
+	items := make([]core.TimelineItem, n)
+	for i := range items {
+		items[i] = core.TimelineItem{
+			ResourceID: fmt.Sprintf("m%025d", n-i),
+			TimelineID: testTimeline,
+			CDate:      newest.Add(-time.Duration(i) * step).Truncate(time.Millisecond),
+		}
+	}
+	return items
+}
+
+func TestOutboxCursor(t *testing.T) {
+	tests := []struct {
+		cursor  string
+		want    time.Time
+		wantErr bool
+	}{
+		{"0", time.UnixMilli(0), false},
+		{"1718000000123", time.UnixMilli(1718000000123), false},
+		{"-1", time.UnixMilli(-1), false},
+		{"", time.Time{}, true},
+		{"1718000000.5", time.Time{}, true},
+		{"abc", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cursor, func(t *testing.T) {
+			got, err := parseOutboxCursor(tt.cursor)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (!got.Equal(tt.want) || outboxCursor(got) != tt.cursor) {
+				t.Fatalf("got %v (%s)", got, outboxCursor(got))
+			}
+		})
+	}
+}
+
+func TestOutboxItems(t *testing.T) {
+	newest := time.Unix(1718000000, 0)
+
+	tests := []struct {
+		name  string
+		items []core.TimelineItem
+		pages []int
+	}{
+		{"one item per minute", testItems(50, newest, time.Minute), []int{20, 20, 10, 0}},
+		{"dense chunks", testItems(45, newest, time.Second), []int{20, 20, 5, 0}},
+		// a page reads at most outboxMaxChunkScans chunks
+		{"sparse chunks", testItems(25, newest, 3*time.Hour), []int{16, 9, 0}},
+		{"a single page", testItems(3, newest, time.Minute), []int{3, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{client: chunkClient{items: tt.items}, config: types.ApConfig{FQDN: "example.com"}}
+
+			// walk the pages through their next cursors like a remote server would
+			maxTime := newest.Add(time.Minute)
+			seen := []core.TimelineItem{}
+			for i, want := range tt.pages {
+				page, err := s.outboxItems(context.Background(), testTimeline, maxTime, time.Time{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(page) != want {
+					t.Fatalf("page %d has %d items, want %d", i, len(page), want)
+				}
+				if len(page) == 0 {
+					break
+				}
+				seen = append(seen, page...)
+
+				maxTime, err = parseOutboxCursor(outboxCursor(page[len(page)-1].CDate))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if len(seen) != len(tt.items) {
+				t.Fatalf("walked %d items, want %d", len(seen), len(tt.items))
+			}
+			for i := range seen {
+				if seen[i].ResourceID != tt.items[i].ResourceID {
+					t.Fatalf("item %d is %s, want %s", i, seen[i].ResourceID, tt.items[i].ResourceID)
+				}
+			}
+		})
+	}
+}
+
+func TestOutboxItemsSince(t *testing.T) {
+	newest := time.Unix(1718000000, 0)
+	items := testItems(50, newest, time.Minute)
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/api/v1/timelines/range" || query.Get("timelines") != testTimeline {
+			http.NotFound(w, r)
+			return
+		}
+		since, err := strconv.ParseInt(query.Get("since"), 10, 64)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		limit, _ := strconv.Atoi(query.Get("limit"))
+
+		// the oldest items from since on, oldest first
+		content := []core.TimelineItem{}
+		for i := len(items) - 1; i >= 0 && len(content) < limit; i-- {
+			if items[i].CDate.Unix() >= since {
+				content = append(content, items[i])
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"status": "ok", "content": content})
+	}))
+	defer server.Close()
+
+	saved := outboxClient
+	outboxClient = server.Client()
+	defer func() { outboxClient = saved }()
+
+	host, _ := url.Parse(server.URL)
+	s := &Service{config: types.ApConfig{FQDN: host.Host}}
+
+	tests := []struct {
+		name    string
+		minTime time.Time
+		newest  int // index into items of the newest item on the page
+		count   int
+	}{
+		{"from the start", time.UnixMilli(0), 30, 20},
+		{"from an item", items[10].CDate, 0, 10},
+		{"from the middle", items[40].CDate, 20, 20},
+		{"within a second of an item", items[40].CDate.Add(-500 * time.Millisecond), 21, 20},
+		{"from the newest", items[0].CDate, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.outboxItemsSince(context.Background(), testTimeline, tt.minTime)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page) != tt.count {
+				t.Fatalf("got %d items, want %d", len(page), tt.count)
+			}
+			for i, item := range page {
+				if item.ResourceID != items[tt.newest+i].ResourceID {
+					t.Fatalf("item %d is %s, want %s", i, item.ResourceID, items[tt.newest+i].ResourceID)
+				}
+			}
+		})
+	}
+}
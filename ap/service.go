@@ -2,6 +2,7 @@ package ap
 
 import (
 	"context"
+	"crypto"
 	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
@@ -10,15 +11,19 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
 
 	"github.com/concrnt/ccworld-ap-bridge/apclient"
 	"github.com/concrnt/ccworld-ap-bridge/bridge"
+	"github.com/concrnt/ccworld-ap-bridge/middleware"
+	"github.com/concrnt/ccworld-ap-bridge/signature"
 	"github.com/concrnt/ccworld-ap-bridge/store"
 	"github.com/concrnt/ccworld-ap-bridge/types"
 	"github.com/concrnt/ccworld-ap-bridge/world"
@@ -27,14 +32,18 @@ import (
 	"github.com/concrnt/concrnt/util"
 	"github.com/concrnt/concrnt/x/jwt"
 	commitStore "github.com/concrnt/concrnt/x/store"
-	"github.com/totegamma/httpsig"
 )
 
+// activityDedupTTL is how long an inbound activity ID is remembered.
+const activityDedupTTL = 7 * 24 * time.Hour
+
 type Service struct {
+	rdb      *redis.Client
 	store    *store.Store
 	client   client.Client
 	apclient *apclient.ApClient
 	bridge   *bridge.Service
+	limiter  *middleware.RateLimiter
 	info     types.NodeInfo
 	config   types.ApConfig
 }
@@ -52,18 +61,22 @@ func createToken(domain, ccid, priv string) (string, error) {
 }
 
 func NewService(
+	rdb *redis.Client,
 	store *store.Store,
 	client client.Client,
 	apclient *apclient.ApClient,
 	bridge *bridge.Service,
+	limiter *middleware.RateLimiter,
 	info types.NodeInfo,
 	config types.ApConfig,
 ) *Service {
 	return &Service{
+		rdb,
 		store,
 		client,
 		apclient,
 		bridge,
+		limiter,
 		info,
 		config,
 	}
@@ -154,6 +167,9 @@ func (s *Service) GetUserWebURL(ctx context.Context, id string) (string, error)
 		span.RecordError(err)
 		return "", err
 	}
+	if entity.TimelineID != "" {
+		return "https://concrnt.world/timeline/" + entity.TimelineID + "@" + s.config.FQDN, nil
+	}
 	return "https://concrnt.world/" + entity.CCID, nil
 }
 
@@ -161,20 +177,35 @@ func (s *Service) User(ctx context.Context, id string) (types.ApObject, error) {
 	ctx, span := tracer.Start(ctx, "Ap.Service.User")
 	defer span.End()
 
+	if id == s.config.FQDN {
+		return s.InstanceActor(ctx)
+	}
+
 	entity, err := s.store.GetEntityByID(ctx, id)
 	if err != nil {
 		span.RecordError(err)
 		return types.ApObject{}, err
 	}
 
-	profile, err := s.client.GetProfile(ctx, entity.CCID+"/world.concrnt.p", &client.Options{Resolver: s.config.FQDN})
+	if entity.TimelineID != "" {
+		return s.bridge.EntityToGroup(ctx, entity)
+	}
+
+	return s.bridge.EntityToPerson(ctx, entity)
+}
+
+// InstanceActor returns the Application actor that acts on behalf of the bridge itself.
+func (s *Service) InstanceActor(ctx context.Context) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.InstanceActor")
+	defer span.End()
+
+	entity, err := s.apclient.InstanceActor(ctx)
 	if err != nil {
 		span.RecordError(err)
 		return types.ApObject{}, err
 	}
 
-	var profileDocument core.ProfileDocument[world.Profile]
-	err = json.Unmarshal([]byte(profile.Document), &profileDocument)
+	assertionMethod, err := s.bridge.AssertionMethod(entity)
 	if err != nil {
 		span.RecordError(err)
 		return types.ApObject{}, err
@@ -184,31 +215,21 @@ func (s *Service) User(ctx context.Context, id string) (types.ApObject, error) {
 		Context: []string{
 			"https://www.w3.org/ns/activitystreams",
 			"https://w3id.org/security/v1",
+			"https://w3id.org/security/multikey/v1",
 		},
-		Type:        "Person",
-		ID:          "https://" + s.config.FQDN + "/ap/acct/" + id,
-		Inbox:       "https://" + s.config.FQDN + "/ap/acct/" + id + "/inbox",
-		Outbox:      "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox",
+		Type:        "Application",
+		ID:          "https://" + s.config.FQDN + "/ap/acct/" + entity.ID,
+		Inbox:       "https://" + s.config.FQDN + "/ap/acct/" + entity.ID + "/inbox",
+		Outbox:      "https://" + s.config.FQDN + "/ap/acct/" + entity.ID + "/outbox",
 		SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
 		Endpoints: &types.PersonEndpoints{
 			SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
 		},
-		PreferredUsername: id,
-		Name:              profileDocument.Body.Username,
-		Summary:           profileDocument.Body.Description,
-		URL:               "https://" + s.config.FQDN + "/ap/acct/" + id,
-		Icon: &types.Icon{
-			Type:      "Image",
-			MediaType: "image/png",
-			URL:       profileDocument.Body.Avatar,
-		},
-		PublicKey: &types.Key{
-			ID:           "https://" + s.config.FQDN + "/ap/acct/" + id + "#main-key",
-			Type:         "Key",
-			Owner:        "https://" + s.config.FQDN + "/ap/acct/" + id,
-			PublicKeyPem: entity.Publickey,
-		},
-		AlsoKnownAs: entity.AlsoKnownAs,
+		PreferredUsername: entity.ID,
+		Name:              s.info.Metadata.NodeName,
+		URL:               "https://" + s.config.FQDN + "/ap/acct/" + entity.ID,
+		PublicKey:         s.bridge.PublicKey(entity),
+		AssertionMethod:   assertionMethod,
 	}, nil
 }
 
@@ -235,81 +256,31 @@ func (s *Service) Note(ctx context.Context, id string) (types.ApObject, error) {
 		return types.ApObject{}, err
 	}
 
-	return note, nil
-}
-
-/*
-https://don-dev.luhrck.com/users/totegamma/outbox
-{
-  "@context": "https://www.w3.org/ns/activitystreams",
-  "id": "https://don-dev.luhrck.com/users/totegamma/outbox",
-  "type": "OrderedCollection",
-  "totalItems": 60,
-  "first": "https://don-dev.luhrck.com/users/totegamma/outbox?page=true",
-  "last": "https://don-dev.luhrck.com/users/totegamma/outbox?min_id=0&page=true"
-}
-*/
-
-/*
-https://don-dev.luhrck.com/users/totegamma/outbox?page=true
-{
-  "@context": [
-    "https://www.w3.org/ns/activitystreams",
-    {
-      "ostatus": "http://ostatus.org#",
-      "atomUri": "ostatus:atomUri",
-      "inReplyToAtomUri": "ostatus:inReplyToAtomUri",
-      "conversation": "ostatus:conversation",
-      "sensitive": "as:sensitive",
-      "toot": "http://joinmastodon.org/ns#",
-      "votersCount": "toot:votersCount",
-      "Hashtag": "as:Hashtag"
-    }
-  ],
-  "id": "https://don-dev.luhrck.com/users/totegamma/outbox?page=true",
-  "type": "OrderedCollectionPage",
-  "next": "https://don-dev.luhrck.com/users/totegamma/outbox?max_id=113912980868238695&page=true",
-  "prev": "https://don-dev.luhrck.com/users/totegamma/outbox?min_id=114543856390108463&page=true",
-  "partOf": "https://don-dev.luhrck.com/users/totegamma/outbox",
-  "orderedItems": [
-    {
-      "id": "https://don-dev.luhrck.com/users/totegamma/statuses/114543856390108463/activity",
-      "type": "Create",
-      "actor": "https://don-dev.luhrck.com/users/totegamma",
-      "published": "2025-05-21T04:09:03Z",
-      "to": [
-        "https://www.w3.org/ns/activitystreams#Public"
-      ],
-      "cc": [
-        "https://don-dev.luhrck.com/users/totegamma/followers"
-      ],
-      "object": {
-*/
-
-func (s *Service) OutboxIndex(ctx context.Context, id string) types.OutboxIndex {
-	return types.OutboxIndex{
-		Context:    "https://www.w3.org/ns/activitystreams",
-		ID:         "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox",
-		Type:       "OrderedCollectionPage",
-		TotalItems: 0,
-		First:      "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox?page=true",
-		Last:       "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox?min_id=0&page=true",
+	// followers-only and direct notes are only handed out by delivery
+	if !bridge.Fetchable(note) {
+		return types.ApObject{}, errors.New("note not found")
 	}
+
+	return note, nil
 }
 
-func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId string, request *http.Request) (types.ApObject, error) {
+func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, body []byte, inboxId string, request *http.Request) (types.ApObject, error) {
 	ctx, span := tracer.Start(ctx, "Ap.Service.Inbox")
 	defer span.End()
 
-	verifier, err := httpsig.NewVerifier(request)
+	err := s.verifyRequest(request, body)
 	if err != nil {
 		span.RecordError(err)
-		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox NewVerifier")
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox verifyRequest")
 	}
 
-	keyid := verifier.KeyId()
-	if keyid == "" {
+	keyid, verify, err := requestVerifier(request)
+	if err != nil {
 		span.RecordError(err)
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox requestVerifier")
+	}
+
+	if keyid == "" {
 		return types.ApObject{}, errors.New("ap/service/inbox KeyId not found")
 	}
 
@@ -324,47 +295,200 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 		recipientEntity = &recipients
 	}
 
-	requester, err := s.apclient.FetchPerson(ctx, keyid, recipientEntity)
+	pub, signer, err := s.fetchPublicKey(ctx, keyid, recipientEntity, false)
 	if err != nil {
 		span.RecordError(err)
-		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox/follow FetchPerson")
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox fetchPublicKey")
 	}
 
-	pubkey, _ := requester.GetRaw("publicKey")
-	if pubkey == nil {
-		span.RecordError(err)
-		return types.ApObject{}, errors.New("ap/service/inbox PublicKey not found: " + keyid)
+	err = verify(pub)
+	if err != nil {
+		// the cached key may be stale after a key rotation; fetch it again and retry once
+		log.Println("ap/service/inbox Verify failed, refetching key", keyid)
+		pub, refetchedSigner, refetchErr := s.fetchPublicKey(ctx, keyid, recipientEntity, true)
+		if refetchErr == nil {
+			signer = refetchedSigner
+			err = verify(pub)
+		}
 	}
-	pemStr := pubkey.MustGetString("publicKeyPem")
+	if err != nil {
+		fmt.Println("Verify error:", err)
 
-	pemBytes := []byte(pemStr)
+		fmt.Println("keyid", keyid)
+
+		util.JsonPrint("header", request.Header)
+		util.JsonPrint("object", object)
 
-	block, _ := pem.Decode(pemBytes)
-	if block == nil {
 		span.RecordError(err)
-		return types.ApObject{}, errors.New("ap/service/inbox Decode error")
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox Verify")
 	}
 
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	// only a verified signer may use up the buckets of an actor or domain
+	err = s.limiter.TakeSigner(ctx, signer)
+	if err != nil {
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox TakeSigner")
+	}
+
+	object, err = s.checkOrigin(ctx, object, signer, recipientEntity)
 	if err != nil {
 		span.RecordError(err)
-		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox ParsePKIXPublicKey")
+		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox checkOrigin")
+	}
+
+	activityID := object.MustGetString("id")
+	dedupKey := activityDedupKey(activityActor(object), activityID)
+	if activityID != "" {
+		fresh, err := s.rdb.SetNX(ctx, dedupKey, time.Now().Unix(), activityDedupTTL).Result()
+		if err != nil {
+			log.Println("ap/service/inbox SetNX", err)
+		} else if !fresh {
+			log.Println("ap/service/inbox activity already processed", activityID)
+			return types.ApObject{}, nil
+		}
+	}
+
+	result, err := s.dispatch(ctx, object, inboxId)
+	if err != nil && activityID != "" {
+		// let the sender's retry go through
+		s.rdb.Del(ctx, dedupKey)
 	}
 
-	err = verifier.Verify(pub, httpsig.RSA_SHA256)
+	return result, err
+}
+
+// fetchPublicKey resolves keyid to a public key and the actor that controls it.
+// keyid may point into an actor document (publicKey) or to a standalone Key object.
+func (s *Service) fetchPublicKey(ctx context.Context, keyid string, execEntity *types.ApEntity, refresh bool) (crypto.PublicKey, string, error) {
+	pub, owner, err := s.resolvePublicKey(ctx, keyid, execEntity, refresh)
 	if err != nil {
-		fmt.Println("Verify error:", err)
+		return nil, "", err
+	}
 
-		fmt.Println("keyid", keyid)
-		fmt.Println("pemStr", pemStr)
+	// standalone keys name their actor; keys embedded in an actor document belong to it
+	controller := owner.MustGetString("controller")
+	if controller == "" {
+		controller = owner.MustGetString("owner")
+	}
+	if controller == "" {
+		controller = owner.MustGetString("id")
+	}
 
-		util.JsonPrint("header", request.Header)
-		util.JsonPrint("object", object)
+	// the key document names its controller by itself; only trust the claim
+	// once the controller's own actor document lists the key
+	actor := owner
+	if owner.MustGetString("id") != controller {
+		if refresh {
+			actor, err = s.apclient.RefetchPerson(ctx, controller, execEntity)
+		} else {
+			actor, err = s.apclient.FetchPerson(ctx, controller, execEntity)
+		}
+		if err != nil {
+			return nil, "", errors.Wrap(err, "FetchPerson")
+		}
+		if actor.MustGetString("id") != controller {
+			return nil, "", fmt.Errorf("%s returned %s", controller, actor.MustGetString("id"))
+		}
+	}
 
-		span.RecordError(err)
-		return types.ApObject{}, errors.Wrap(err, "ap/service/inbox Verify")
+	if !slices.Contains(listedKeyIDs(actor), keyid) {
+		return nil, "", fmt.Errorf("%s does not list %s", controller, keyid)
+	}
+
+	return pub, controller, nil
+}
+
+// listedKeyIDs returns the ids of the keys an actor document claims in publicKey and assertionMethod.
+func listedKeyIDs(actor *types.RawApObj) []string {
+	var ids []string
+	for _, property := range []string{"publicKey", "assertionMethod"} {
+		value, ok := actor.GetData()[property]
+		if !ok {
+			continue
+		}
+		items, ok := value.([]any)
+		if !ok {
+			items = []any{value}
+		}
+		for _, item := range items {
+			switch key := item.(type) {
+			case string:
+				ids = append(ids, key)
+			case map[string]any:
+				if id, ok := key["id"].(string); ok {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+func (s *Service) resolvePublicKey(ctx context.Context, keyid string, execEntity *types.ApEntity, refresh bool) (crypto.PublicKey, *types.RawApObj, error) {
+	var owner *types.RawApObj
+	var err error
+	if refresh {
+		owner, err = s.apclient.RefetchPerson(ctx, keyid, execEntity)
+	} else {
+		owner, err = s.apclient.FetchPerson(ctx, keyid, execEntity)
+	}
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "FetchPerson")
+	}
+
+	// FEP-521a: standalone Multikey or one listed in assertionMethod
+	if multibase := owner.MustGetString("publicKeyMultibase"); multibase != "" {
+		pub, err := signature.DecodeMultikey(multibase)
+		return pub, owner, err
+	}
+	for _, key := range owner.MustGetRawSlice("assertionMethod") {
+		if key.MustGetString("id") == keyid {
+			pub, err := signature.DecodeMultikey(key.MustGetString("publicKeyMultibase"))
+			return pub, owner, err
+		}
+	}
+
+	pemStr := owner.MustGetString("publicKeyPem")
+	if pemStr == "" {
+		for _, key := range owner.MustGetRawSlice("publicKey") {
+			if key.MustGetString("id") == keyid {
+				pemStr = key.MustGetString("publicKeyPem")
+				break
+			}
+		}
+	}
+	if pemStr == "" {
+		if key, ok := owner.GetRaw("publicKey"); ok {
+			pemStr = key.MustGetString("publicKeyPem")
+		}
+	}
+	if pemStr == "" {
+		return nil, nil, errors.New("PublicKey not found: " + keyid)
 	}
 
+	block, _ := pem.Decode([]byte(pemStr))
+	if block == nil {
+		return nil, nil, errors.New("Decode error")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "ParsePKIXPublicKey")
+	}
+
+	return pub, owner, nil
+}
+
+// activityDedupKey scopes an activity id by its verified actor,
+// so that nobody can claim the id of someone else's activity ahead of it.
+func activityDedupKey(actor, id string) string {
+	return "ap:activity:" + actor + "\x00" + id
+}
+
+// dispatch processes a verified inbound activity.
+func (s *Service) dispatch(ctx context.Context, object *types.RawApObj, inboxId string) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.Dispatch")
+	defer span.End()
+
 	switch object.MustGetString("type") {
 	case "Follow":
 		id := inboxId
@@ -615,7 +739,7 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 		switch createType {
 		case "Note":
 			// check if the note is already exists
-			_, err := s.store.GetApObjectReferenceByCcObjectID(ctx, createID)
+			_, err := s.store.GetApObjectReferenceByApObjectID(ctx, createID)
 			if err == nil {
 				// already exists
 				log.Println("ap/service/inbox/create note already exists")
@@ -639,6 +763,11 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 			// list up to and ccs
 			to, _ := createObject.GetStringSlice("to")
 			cc, _ := createObject.GetStringSlice("cc")
+
+			// only posts anyone may see (public or unlisted) go to community timelines
+			public := slices.Contains(append(to, cc...), "https://www.w3.org/ns/activitystreams#Public")
+			groups := map[string]types.ApEntity{}
+
 			for _, recipient := range append(to, cc...) {
 				if strings.HasPrefix(recipient, "https://"+s.config.FQDN+"/ap/acct/") {
 					recipient = strings.TrimPrefix(recipient, "https://"+s.config.FQDN+"/ap/acct/")
@@ -648,6 +777,17 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 						span.RecordError(err)
 						continue
 					}
+					if entity.TimelineID != "" {
+						// posts addressed to a Group go into its community timeline
+						if public {
+							if rep.ID == "" {
+								rep = entity
+							}
+							destStreams = append(destStreams, entity.TimelineID+"@"+s.config.FQDN)
+							groups[entity.ID] = entity
+						}
+						continue
+					}
 					if rep.ID == "" {
 						rep = entity
 					}
@@ -655,6 +795,31 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 				}
 			}
 
+			// FEP-1b12 audience and mentions of a Group
+			var groupRefs []string
+			if public {
+				groupRefs = append(groupRefs, createObject.MustGetString("audience"))
+				for _, tag := range createObject.MustGetRawSlice("tag") {
+					if tag.MustGetString("type") == "Mention" {
+						groupRefs = append(groupRefs, tag.MustGetString("href"))
+					}
+				}
+			}
+			for _, ref := range groupRefs {
+				if !strings.HasPrefix(ref, "https://"+s.config.FQDN+"/ap/acct/") {
+					continue
+				}
+				entity, err := s.store.GetEntityByID(ctx, strings.TrimPrefix(ref, "https://"+s.config.FQDN+"/ap/acct/"))
+				if err != nil || entity.TimelineID == "" {
+					continue
+				}
+				if rep.ID == "" {
+					rep = entity
+				}
+				destStreams = append(destStreams, entity.TimelineID+"@"+s.config.FQDN)
+				groups[entity.ID] = entity
+			}
+
 			// list up follows
 			follows, err := s.store.GetFollowsByPublisher(ctx, object.MustGetString("actor"))
 			if err != nil {
@@ -706,6 +871,18 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 				ApObjectID: createID,
 				CcObjectID: created.ID,
 			})
+			if err != nil {
+				span.RecordError(err)
+				return types.ApObject{}, nil
+			}
+
+			// the group worker leaves posts from the fediverse to the inbox,
+			// which announces them once their reference is saved; unlisted ones are not announced
+			if slices.Contains(to, "https://www.w3.org/ns/activitystreams#Public") {
+				for _, group := range groups {
+					go s.announceGroupPost(context.WithoutCancel(ctx), group, created)
+				}
+			}
 
 			return types.ApObject{}, nil
 		default:
@@ -725,7 +902,7 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 			return types.ApObject{}, errors.New("ap/service/inbox/announce Invalid Announce Object")
 		}
 		// check if the note is already exists
-		_, err := s.store.GetApObjectReferenceByCcObjectID(ctx, object.MustGetString("id"))
+		_, err := s.store.GetApObjectReferenceByApObjectID(ctx, object.MustGetString("id"))
 		if err == nil {
 			// already exists
 			log.Println("ap/service/inbox/announce note already exists")
@@ -920,6 +1097,10 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 				span.RecordError(err)
 				return types.ApObject{}, errors.Wrap(err, "ap/service/inbox/accept GetFollowByID")
 			}
+			// only the followed actor may accept
+			if apFollow.PublisherPersonURL != object.MustGetString("actor") {
+				return types.ApObject{}, fmt.Errorf("ap/service/inbox/accept %s is not the followee of %s", object.MustGetString("actor"), objectID)
+			}
 			apFollow.Accepted = true
 
 			_, err = s.store.UpdateFollow(ctx, apFollow)
@@ -984,6 +1165,22 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 				return types.ApObject{}, errors.Wrap(err, "ap/service/inbox/undo/like GetApObjectReferenceByApObjectID")
 			}
 
+			// the association records who liked; nobody else may take it back
+			association, err := s.client.GetAssociation(ctx, deleteRef.CcObjectID, &client.Options{Resolver: s.config.FQDN})
+			if err != nil {
+				span.RecordError(err)
+				return types.ApObject{}, errors.Wrap(err, "ap/service/inbox/undo/like GetAssociation")
+			}
+			var likeDocument core.DocumentBase[any]
+			err = json.Unmarshal([]byte(association.Document), &likeDocument)
+			if err != nil {
+				span.RecordError(err)
+				return types.ApObject{}, errors.Wrap(err, "ap/service/inbox/undo/like Unmarshal")
+			}
+			if meta, _ := likeDocument.Meta.(map[string]any); meta == nil || meta["apActor"] != object.MustGetString("actor") {
+				return types.ApObject{}, fmt.Errorf("ap/service/inbox/undo/like %s is not the actor of %s", object.MustGetString("actor"), likeID)
+			}
+
 			doc := core.DeleteDocument{
 				DocumentBase: core.DocumentBase[any]{
 					Signer:   s.config.ProxyCCID,
@@ -1129,3 +1326,17 @@ func (s *Service) Inbox(ctx context.Context, object *types.RawApObj, inboxId str
 		return types.ApObject{}, nil
 	}
 }
+
+// announceGroupPost delivers the Announce of a post from the fediverse to the followers of a group it was addressed to.
+func (s *Service) announceGroupPost(ctx context.Context, group types.ApEntity, message core.Message) {
+	announce, err := s.bridge.GroupAnnounce(ctx, group, message.ID, message.CDate)
+	if err != nil {
+		log.Printf("ap/service/group/%v GroupAnnounce %v", group.ID, err)
+		return
+	}
+
+	err = s.apclient.DeliverToFollowers(ctx, announce, group)
+	if err != nil {
+		log.Printf("ap/service/group/%v DeliverToFollowers %v", group.ID, err)
+	}
+}
@@ -0,0 +1,28 @@
+package ap
+
+import "testing"
+
+func TestActivityDedupKey(t *testing.T) {
+	const id = "https://victim.example/activities/123"
+
+	tests := []struct {
+		name             string
+		actorA, idA      string
+		actorB, idB      string
+		wantSameDelivery bool
+	}{
+		{"same activity redelivered", "https://victim.example/users/alice", id, "https://victim.example/users/alice", id, true},
+		{"id claimed by another actor", "https://evil.example/users/mallory", id, "https://victim.example/users/alice", id, false},
+		{"same actor, other activity", "https://victim.example/users/alice", id, "https://victim.example/users/alice", id + "/undo", false},
+		{"boundary between actor and id", "https://a.example/u", "x", "https://a.example/ux", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			same := activityDedupKey(tt.actorA, tt.idA) == activityDedupKey(tt.actorB, tt.idB)
+			if same != tt.wantSameDelivery {
+				t.Fatalf("same key = %v, want %v", same, tt.wantSameDelivery)
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package ap
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/totegamma/httpsig"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const defaultClockSkew = 5 * time.Minute
+
+var rejectedRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ccapi",
+		Subsystem: "inbox",
+		Name:      "rejected_total",
+		Help:      "Number of inbound deliveries rejected by request verification.",
+	},
+	[]string{"reason"},
+)
+
+// VerificationError is returned when an inbound request fails signature related checks.
+type VerificationError struct {
+	Reason string
+	Err    error
+}
+
+func (e *VerificationError) Error() string {
+	if e.Err == nil {
+		return e.Reason
+	}
+	return e.Reason + ": " + e.Err.Error()
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.Err
+}
+
+func reject(reason string, err error) error {
+	rejectedRequests.WithLabelValues(reason).Inc()
+	return &VerificationError{Reason: reason, Err: err}
+}
+
+// requestVerifier parses the request signature in either draft-cavage or RFC 9421 format.
+// It returns the key ID and a function that checks the signature against a public key.
+func requestVerifier(request *http.Request) (string, func(crypto.PublicKey) error, error) {
+	if signature.IsRFC9421(request) {
+		input, sig, err := signature.ParseRequest(request)
+		if err != nil {
+			return "", nil, errors.Wrap(err, "ParseRequest")
+		}
+		return input.KeyID, func(pub crypto.PublicKey) error {
+			return signature.Verify(request, input, sig, pub)
+		}, nil
+	}
+
+	verifier, err := httpsig.NewVerifier(request)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "NewVerifier")
+	}
+	return verifier.KeyId(), func(pub crypto.PublicKey) error {
+		return verifier.Verify(pub, httpsig.RSA_SHA256)
+	}, nil
+}
+
+// verifyRequest checks the Date freshness and the body Digest of an inbound request.
+func (s *Service) verifyRequest(request *http.Request, body []byte) error {
+	if signature.IsRFC9421(request) {
+		return s.verifyRFC9421Request(request, body)
+	}
+
+	params := signature.CavageParams(request.Header.Get("Signature"))
+	signed := strings.Fields(strings.ToLower(params["headers"]))
+	if len(signed) == 0 {
+		signed = []string{"date"}
+	}
+
+	err := s.verifyDate(request, slices.Contains(signed, "date"))
+	if err != nil {
+		return err
+	}
+
+	if request.Method != http.MethodPost {
+		return nil
+	}
+
+	if !slices.Contains(signed, "digest") {
+		return reject("digest_not_signed", nil)
+	}
+
+	digestHeader := request.Header.Get("Digest")
+	if digestHeader == "" {
+		return reject("digest_missing", nil)
+	}
+
+	for _, digest := range strings.Split(digestHeader, ",") {
+		algo, value, ok := strings.Cut(strings.TrimSpace(digest), "=")
+		if !ok {
+			continue
+		}
+
+		var h hash.Hash
+		switch strings.ToUpper(algo) {
+		case "SHA-256":
+			h = sha256.New()
+		case "SHA-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+
+		expected, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return reject("digest_invalid", err)
+		}
+
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+			return reject("digest_mismatch", nil)
+		}
+		return nil
+	}
+
+	return reject("digest_unsupported", fmt.Errorf("digest %s", digestHeader))
+}
+
+// verifyRFC9421Request applies the same policy to RFC 9421 signatures,
+// using the created parameter and Content-Digest.
+func (s *Service) verifyRFC9421Request(request *http.Request, body []byte) error {
+	input, _, err := signature.ParseRequest(request)
+	if err != nil {
+		return reject("signature_invalid", err)
+	}
+
+	// the signature has to be bound to this very request
+	for _, component := range []string{"@method", "@target-uri"} {
+		if !input.HasComponent(component) {
+			return reject("component_not_signed", fmt.Errorf("%s is not covered", component))
+		}
+	}
+
+	if input.Created != 0 {
+		created := time.Unix(input.Created, 0)
+		if diff := time.Since(created); diff > s.clockSkew() || diff < -s.clockSkew() {
+			return reject("created_out_of_window", fmt.Errorf("created %d", input.Created))
+		}
+	} else {
+		err := s.verifyDate(request, input.HasComponent("date"))
+		if err != nil {
+			return err
+		}
+	}
+
+	if input.Expires != 0 && time.Now().Unix() > input.Expires {
+		return reject("signature_expired", nil)
+	}
+
+	if request.Method != http.MethodPost {
+		return nil
+	}
+
+	if !input.HasComponent("content-digest") {
+		return reject("digest_not_signed", nil)
+	}
+
+	digestHeader := request.Header.Get("Content-Digest")
+	if digestHeader == "" {
+		return reject("digest_missing", nil)
+	}
+
+	err = signature.VerifyContentDigest(digestHeader, body)
+	switch {
+	case errors.Is(err, signature.ErrDigestMismatch):
+		return reject("digest_mismatch", nil)
+	case errors.Is(err, signature.ErrDigestUnsupported):
+		return reject("digest_unsupported", fmt.Errorf("digest %s", digestHeader))
+	case err != nil:
+		return reject("digest_invalid", err)
+	}
+
+	return nil
+}
+
+func (s *Service) verifyDate(request *http.Request, signed bool) error {
+	dateHeader := request.Header.Get("Date")
+	if dateHeader == "" {
+		return reject("date_missing", nil)
+	}
+	if !signed {
+		return reject("date_not_signed", nil)
+	}
+
+	date, err := http.ParseTime(dateHeader)
+	if err != nil {
+		return reject("date_invalid", err)
+	}
+
+	if diff := time.Since(date); diff > s.clockSkew() || diff < -s.clockSkew() {
+		return reject("date_out_of_window", fmt.Errorf("date %s", dateHeader))
+	}
+
+	return nil
+}
+
+func (s *Service) clockSkew() time.Duration {
+	if s.config.ClockSkew > 0 {
+		return time.Duration(s.config.ClockSkew) * time.Second
+	}
+	return defaultClockSkew
+}
+
+// checkOrigin makes sure the activity really comes from its actor.
+// The signer has to be the actor itself. Activities relayed by a third party (e.g. replies forwarded
+// to followers) are accepted with a valid integrity proof, otherwise the copy held by the actor's origin is used instead.
+func (s *Service) checkOrigin(ctx context.Context, object *types.RawApObj, signer string, execEntity *types.ApEntity) (*types.RawApObj, error) {
+	actor := activityActor(object)
+	if actor == "" {
+		return nil, reject("actor_missing", nil)
+	}
+	actorOrigin := origin(actor)
+
+	if actor != signer {
+		proofErr := s.verifyObjectProof(ctx, object, actor, execEntity)
+		if proofErr != nil {
+			log.Printf("ap/service/inbox signer %s is not %s (%v), fetching from origin", signer, actor, proofErr)
+
+			fetched, err := s.fetchFromOrigin(ctx, object, actor, execEntity)
+			if err != nil {
+				return nil, reject("origin_mismatch", err)
+			}
+			object = fetched
+		}
+	}
+
+	// an actor may only create, update or delete objects on its own origin
+	switch object.MustGetString("type") {
+	case "Create", "Update", "Delete":
+		objectID := activityObjectID(object)
+		if objectID != "" && origin(objectID) != actorOrigin {
+			return nil, reject("object_origin_mismatch", fmt.Errorf("%s is not on the origin of %s", objectID, actor))
+		}
+	case "Undo":
+		// only the actor of an activity may undo it
+		inner, ok := object.GetRaw("object")
+		if !ok {
+			break
+		}
+		if innerActor := activityActor(inner); innerActor != actor {
+			return nil, reject("undo_actor_mismatch", fmt.Errorf("%s can not undo an activity of %s", actor, innerActor))
+		}
+		if innerID := inner.MustGetString("id"); innerID != "" && origin(innerID) != actorOrigin {
+			return nil, reject("object_origin_mismatch", fmt.Errorf("%s is not on the origin of %s", innerID, actor))
+		}
+	}
+
+	return object, nil
+}
+
+// fetchFromOrigin fetches the activity, or the object it carries, from the origin of actor.
+func (s *Service) fetchFromOrigin(ctx context.Context, object *types.RawApObj, actor string, execEntity *types.ApEntity) (*types.RawApObj, error) {
+	ctx, span := tracer.Start(ctx, "Ap.Service.FetchFromOrigin")
+	defer span.End()
+
+	var signer types.ApEntity
+	if execEntity != nil {
+		signer = *execEntity
+	} else {
+		instanceActor, err := s.apclient.InstanceActor(ctx)
+		if err != nil {
+			span.RecordError(err)
+			return nil, errors.Wrap(err, "InstanceActor")
+		}
+		signer = instanceActor
+	}
+
+	actorOrigin := origin(actor)
+
+	forwardedID := object.MustGetString("id")
+	if forwardedID != "" && origin(forwardedID) == actorOrigin {
+		fetched, err := s.apclient.FetchNote(ctx, forwardedID, signer)
+		if err == nil && fetched.MustGetString("id") == forwardedID && activityActor(fetched) == actor {
+			return fetched, nil
+		}
+	}
+
+	// many servers do not serve their activities; fall back to the object itself
+	switch object.MustGetString("type") {
+	case "Create", "Update":
+	default:
+		return nil, fmt.Errorf("could not fetch %s from its origin", forwardedID)
+	}
+
+	objectID := activityObjectID(object)
+	if objectID == "" || origin(objectID) != actorOrigin {
+		return nil, fmt.Errorf("object %s is not on the origin of %s", objectID, actor)
+	}
+
+	fetched, err := s.apclient.FetchNote(ctx, objectID, signer)
+	if err != nil {
+		span.RecordError(err)
+		return nil, errors.Wrap(err, "FetchNote")
+	}
+	if fetched.MustGetString("id") != objectID {
+		return nil, fmt.Errorf("origin returned %s for %s", fetched.MustGetString("id"), objectID)
+	}
+	if !slices.Contains(attributedTo(fetched), actor) {
+		return nil, fmt.Errorf("%s is not attributed to %s", objectID, actor)
+	}
+
+	// nothing of the forwarded activity is trusted; rebuild it around the verified object
+	activityType := object.MustGetString("type")
+	activityID := objectID + "#" + strings.ToLower(activityType)
+	if updated := fetched.MustGetString("updated"); activityType == "Update" && updated != "" {
+		activityID += "-" + updated
+	}
+
+	activity := map[string]any{
+		"id":     activityID,
+		"type":   activityType,
+		"actor":  actor,
+		"object": fetched.GetData(),
+	}
+	for _, key := range []string{"@context", "to", "cc"} {
+		if value, ok := fetched.GetData()[key]; ok {
+			activity[key] = value
+		}
+	}
+
+	activityBytes, err := json.Marshal(activity)
+	if err != nil {
+		return nil, err
+	}
+	return types.LoadAsRawApObj(activityBytes)
+}
+
+// verifyObjectProof checks the FEP-8b32 integrity proof of an activity made by actor.
+func (s *Service) verifyObjectProof(ctx context.Context, object *types.RawApObj, actor string, execEntity *types.ApEntity) error {
+	document := object.GetData()
+
+	verificationMethod, ok := signature.ProofVerificationMethod(document)
+	if !ok {
+		return reject("actor_mismatch", fmt.Errorf("signer is not %s and no proof is present", actor))
+	}
+
+	pub, controller, err := s.fetchPublicKey(ctx, verificationMethod, execEntity, false)
+	if err != nil {
+		return reject("proof_key_unavailable", err)
+	}
+	if controller != actor {
+		return reject("proof_controller_mismatch", fmt.Errorf("%s is controlled by %s", verificationMethod, controller))
+	}
+
+	err = signature.VerifyProof(document, pub)
+	if err != nil {
+		pub, _, refetchErr := s.fetchPublicKey(ctx, verificationMethod, execEntity, true)
+		if refetchErr == nil {
+			err = signature.VerifyProof(document, pub)
+		}
+	}
+	if err != nil {
+		return reject("proof_invalid", err)
+	}
+
+	return nil
+}
+
+// activityActor returns the id of the actor of an activity.
+func activityActor(object *types.RawApObj) string {
+	if actor, ok := object.GetString("actor"); ok {
+		return actor
+	}
+	if actor, ok := object.GetRaw("actor"); ok {
+		return actor.MustGetString("id")
+	}
+	return ""
+}
+
+// attributedTo returns the ids of the actors an object is attributed to.
+func attributedTo(object *types.RawApObj) []string {
+	var ids []string
+	value := object.GetData()["attributedTo"]
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			ids = append(ids, v)
+		case map[string]any:
+			if id, ok := v["id"].(string); ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// activityObjectID returns the id of the object of an activity.
+func activityObjectID(object *types.RawApObj) string {
+	if id, ok := object.GetString("object"); ok {
+		return id
+	}
+	if inner, ok := object.GetRaw("object"); ok {
+		return inner.MustGetString("id")
+	}
+	return ""
+}
+
+// origin returns the scheme and host of an id.
+func origin(id string) string {
+	u, err := url.Parse(id)
+	if err != nil || u.Host == "" {
+		return id
+	}
+	return u.Scheme + "://" + strings.ToLower(u.Host)
+}
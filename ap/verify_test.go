@@ -0,0 +1,218 @@
+package ap
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+var testBody = []byte(`{"type":"Follow"}`)
+
+func sha256Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func sha512Digest(body []byte) string {
+	sum := sha512.Sum512(body)
+	return "SHA-512=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func httpDate(offset time.Duration) string {
+	return time.Now().Add(offset).UTC().Format(http.TimeFormat)
+}
+
+// rejection returns the reason of a verification error, or "" when err is nil.
+func rejection(t *testing.T, err error) string {
+	t.Helper()
+	if err == nil {
+		return ""
+	}
+	var verr *VerificationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return verr.Reason
+}
+
+func TestVerifyRequestCavage(t *testing.T) {
+	const postHeaders = "(request-target) host date digest"
+
+	tests := []struct {
+		name      string
+		method    string
+		headers   string // signed headers; empty leaves the parameter out
+		date      string
+		digest    string
+		clockSkew int
+		want      string
+	}{
+		{"get", http.MethodGet, "(request-target) host date", httpDate(0), "", 0, ""},
+		{"headers default to date", http.MethodGet, "", httpDate(0), "", 0, ""},
+		{"date missing", http.MethodGet, "(request-target) host date", "", "", 0, "date_missing"},
+		{"date not signed", http.MethodGet, "(request-target) host", httpDate(0), "", 0, "date_not_signed"},
+		{"date invalid", http.MethodGet, "(request-target) host date", "yesterday", "", 0, "date_invalid"},
+		{"date in the past", http.MethodGet, "(request-target) host date", httpDate(-6 * time.Minute), "", 0, "date_out_of_window"},
+		{"date in the future", http.MethodGet, "(request-target) host date", httpDate(6 * time.Minute), "", 0, "date_out_of_window"},
+		{"date within the default skew", http.MethodGet, "(request-target) host date", httpDate(-4 * time.Minute), "", 0, ""},
+		{"date within a configured skew", http.MethodGet, "(request-target) host date", httpDate(-8 * time.Minute), "", 600, ""},
+		{"date outside a configured skew", http.MethodGet, "(request-target) host date", httpDate(-2 * time.Minute), "", 60, "date_out_of_window"},
+		{"post", http.MethodPost, postHeaders, httpDate(0), sha256Digest(testBody), 0, ""},
+		{"post sha-512", http.MethodPost, postHeaders, httpDate(0), sha512Digest(testBody), 0, ""},
+		{"post algorithm case", http.MethodPost, postHeaders, httpDate(0), "sha-256=" + sha256Digest(testBody)[len("SHA-256="):], 0, ""},
+		{"post unknown algorithm first", http.MethodPost, postHeaders, httpDate(0), "MD5=AAAA, " + sha256Digest(testBody), 0, ""},
+		{"post digest not signed", http.MethodPost, "(request-target) host date", httpDate(0), sha256Digest(testBody), 0, "digest_not_signed"},
+		{"post digest missing", http.MethodPost, postHeaders, httpDate(0), "", 0, "digest_missing"},
+		{"post digest mismatch", http.MethodPost, postHeaders, httpDate(0), sha256Digest([]byte("{}")), 0, "digest_mismatch"},
+		{"post digest unsupported", http.MethodPost, postHeaders, httpDate(0), "MD5=AAAA", 0, "digest_unsupported"},
+		{"post digest invalid", http.MethodPost, postHeaders, httpDate(0), "SHA-256=***", 0, "digest_invalid"},
+		{"post stale date", http.MethodPost, postHeaders, httpDate(-time.Hour), sha256Digest(testBody), 0, "date_out_of_window"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{config: types.ApConfig{ClockSkew: tt.clockSkew}}
+
+			r := httptest.NewRequest(tt.method, "https://example.com/ap/inbox", nil)
+			params := `keyId="https://remote.example/actor#main-key",algorithm="rsa-sha256",signature="AAAA"`
+			if tt.headers != "" {
+				params += fmt.Sprintf(`,headers="%s"`, tt.headers)
+			}
+			r.Header.Set("Signature", params)
+			if tt.date != "" {
+				r.Header.Set("Date", tt.date)
+			}
+			if tt.digest != "" {
+				r.Header.Set("Digest", tt.digest)
+			}
+
+			got := rejection(t, s.verifyRequest(r, testBody))
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestRFC9421(t *testing.T) {
+	now := time.Now().Unix()
+	const postComponents = `"@method" "@target-uri" "content-digest"`
+
+	tests := []struct {
+		name       string
+		method     string
+		components string
+		params     string
+		date       string
+		digest     string
+		want       string
+	}{
+		{"post", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now), "", signature.ContentDigest(testBody), ""},
+		{"get", http.MethodGet, `"@method" "@target-uri"`, fmt.Sprintf(";created=%d", now), "", "", ""},
+		{"method not signed", http.MethodPost, `"@target-uri" "content-digest"`, fmt.Sprintf(";created=%d", now), "", signature.ContentDigest(testBody), "component_not_signed"},
+		{"target not signed", http.MethodPost, `"@method" "@path" "content-digest"`, fmt.Sprintf(";created=%d", now), "", signature.ContentDigest(testBody), "component_not_signed"},
+		{"created in the past", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now-360), "", signature.ContentDigest(testBody), "created_out_of_window"},
+		{"created in the future", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now+360), "", signature.ContentDigest(testBody), "created_out_of_window"},
+		{"expired", http.MethodPost, postComponents, fmt.Sprintf(";created=%d;expires=%d", now-10, now-1), "", signature.ContentDigest(testBody), "signature_expired"},
+		{"date instead of created", http.MethodGet, `"@method" "@target-uri" "date"`, "", httpDate(0), "", ""},
+		{"no created and date not signed", http.MethodGet, `"@method" "@target-uri"`, "", httpDate(0), "", "date_not_signed"},
+		{"no created and stale date", http.MethodGet, `"@method" "@target-uri" "date"`, "", httpDate(-time.Hour), "", "date_out_of_window"},
+		{"digest not signed", http.MethodPost, `"@method" "@target-uri"`, fmt.Sprintf(";created=%d", now), "", signature.ContentDigest(testBody), "digest_not_signed"},
+		{"digest missing", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now), "", "", "digest_missing"},
+		{"digest mismatch", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now), "", signature.ContentDigest([]byte("{}")), "digest_mismatch"},
+		{"digest unsupported", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now), "", "md5=:AAAA:", "digest_unsupported"},
+		{"digest invalid", http.MethodPost, postComponents, fmt.Sprintf(";created=%d", now), "", "sha-256=AAAA", "digest_invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Service{}
+
+			r := httptest.NewRequest(tt.method, "https://example.com/ap/inbox", nil)
+			r.Header.Set("Signature-Input", fmt.Sprintf(`sig1=(%s)%s;keyid="https://remote.example/actor#ed25519-key"`, tt.components, tt.params))
+			r.Header.Set("Signature", "sig1=:AAAA:")
+			if tt.date != "" {
+				r.Header.Set("Date", tt.date)
+			}
+			if tt.digest != "" {
+				r.Header.Set("Content-Digest", tt.digest)
+			}
+
+			got := rejection(t, s.verifyRequest(r, testBody))
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckOrigin(t *testing.T) {
+	const alice = "https://remote.example/users/alice"
+
+	tests := []struct {
+		name     string
+		activity string
+		want     string
+	}{
+		{"create", `{"type":"Create","actor":"` + alice + `","object":{"id":"https://remote.example/notes/1"}}`, ""},
+		{"create elsewhere", `{"type":"Create","actor":"` + alice + `","object":{"id":"https://other.example/notes/1"}}`, "object_origin_mismatch"},
+		{"delete elsewhere", `{"type":"Delete","actor":"` + alice + `","object":"https://other.example/notes/1"}`, "object_origin_mismatch"},
+		{"no actor", `{"type":"Create","object":{"id":"https://remote.example/notes/1"}}`, "actor_missing"},
+		{"undo follow", `{"type":"Undo","actor":"` + alice + `","object":{"id":"https://remote.example/follows/1","type":"Follow","actor":"` + alice + `"}}`, ""},
+		{"undo follow of another actor", `{"type":"Undo","actor":"` + alice + `","object":{"id":"https://remote.example/follows/1","type":"Follow","actor":"https://remote.example/users/bob"}}`, "undo_actor_mismatch"},
+		{"undo without inner actor", `{"type":"Undo","actor":"` + alice + `","object":{"id":"https://remote.example/likes/1","type":"Like"}}`, "undo_actor_mismatch"},
+		{"undo like elsewhere", `{"type":"Undo","actor":"` + alice + `","object":{"id":"https://other.example/likes/1","type":"Like","actor":"` + alice + `"}}`, "object_origin_mismatch"},
+		{"undo by id", `{"type":"Undo","actor":"` + alice + `","object":"https://remote.example/likes/1"}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := types.LoadAsRawApObj([]byte(tt.activity))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &Service{}
+			_, err = s.checkOrigin(context.Background(), object, alice, nil)
+			if got := rejection(t, err); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttributedTo(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		want   []string
+	}{
+		{"string", `{"attributedTo":"https://remote.example/users/alice"}`, []string{"https://remote.example/users/alice"}},
+		{"object", `{"attributedTo":{"id":"https://remote.example/users/alice","type":"Person"}}`, []string{"https://remote.example/users/alice"}},
+		{"array", `{"attributedTo":[{"id":"https://remote.example/users/alice"},"https://remote.example/channels/1"]}`, []string{"https://remote.example/users/alice", "https://remote.example/channels/1"}},
+		{"missing", `{}`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object, err := types.LoadAsRawApObj([]byte(tt.object))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := attributedTo(object); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package apclient
+
+import (
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcache is optional; without it every lookup misses and writes are dropped.
+
+func (c ApClient) cacheGet(key string) (*memcache.Item, error) {
+	if c.mc == nil {
+		return nil, memcache.ErrCacheMiss
+	}
+	return c.mc.Get(key)
+}
+
+func (c ApClient) cacheSet(item *memcache.Item) {
+	if c.mc == nil {
+		return
+	}
+	c.mc.Set(item)
+}
+
+func (c ApClient) cacheAdd(item *memcache.Item) error {
+	if c.mc == nil {
+		return nil
+	}
+	return c.mc.Add(item)
+}
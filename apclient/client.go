@@ -1,20 +1,18 @@
 package apclient
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
-	"github.com/totegamma/httpsig"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 
 	"github.com/concrnt/ccworld-ap-bridge/store"
 	"github.com/concrnt/ccworld-ap-bridge/types"
@@ -44,43 +42,27 @@ func NewApClient(
 	}
 }
 
+// ErrObjectNotFound is returned when the remote server has no object for the given id.
+var ErrObjectNotFound = fmt.Errorf("object not found")
+
 // FetchNote fetches a note from remote ap server.
 func (c ApClient) FetchNote(ctx context.Context, noteID string, execEntity types.ApEntity) (*types.RawApObj, error) {
 	_, span := tracer.Start(ctx, "FetchNote")
 	defer span.End()
 
-	req, err := http.NewRequest("GET", noteID, nil)
-	if err != nil {
-		return nil, err
-	}
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	req.Header.Set("Accept", "application/activity+json")
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set("Host", req.URL.Host)
-	client := new(http.Client)
-
-	priv, err := c.store.LoadKey(ctx, execEntity)
+	resp, err := c.do(ctx, "GET", noteID, nil, &execEntity)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
-	digestAlgorithm := httpsig.DigestSha256
-	headersToSign := []string{httpsig.RequestTarget, "date", "host"}
-	signer, _, err := httpsig.NewSigner(prefs, digestAlgorithm, headersToSign, httpsig.Signature, 0)
-	if err != nil {
-		log.Println(err)
-		return nil, err
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return nil, ErrObjectNotFound
 	}
-	err = signer.SignRequest(priv, "https://"+c.config.FQDN+"/ap/acct/"+execEntity.ID+"#main-key", req, nil)
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetch %s: %s", noteID, resp.Status)
 	}
-	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -96,12 +78,16 @@ func (c ApClient) FetchNote(ctx context.Context, noteID string, execEntity types
 }
 
 // FetchPerson fetches a person from remote ap server.
+// It reads through memcache and the remote_actors table, and only goes remote when the stored copy is too old.
 func (c ApClient) FetchPerson(ctx context.Context, actor string, execEntity *types.ApEntity) (*types.RawApObj, error) {
-	_, span := tracer.Start(ctx, "FetchPerson")
+	ctx, span := tracer.Start(ctx, "FetchPerson")
 	defer span.End()
 
+	// key ids like https://example.com/users/alice#main-key are served by the actor document
+	actor = documentURL(actor)
+
 	// try cache
-	cache, err := c.mc.Get(actor)
+	cache, err := c.cacheGet(actor)
 	if err == nil {
 		person, err := types.LoadAsRawApObj(cache.Value)
 		if err == nil {
@@ -109,41 +95,66 @@ func (c ApClient) FetchPerson(ctx context.Context, actor string, execEntity *typ
 		}
 	}
 
-	req, err := http.NewRequest("GET", actor, nil)
-	if err != nil {
-		return nil, err
-	}
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	req.Header.Set("Accept", "application/activity+json")
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set("Host", req.URL.Host)
-	client := new(http.Client)
-
-	if execEntity != nil {
-		priv, err := c.store.LoadKey(ctx, *execEntity)
-		if err != nil {
-			log.Println(err)
-			return nil, err
+	// rows without a fetch time are placeholders for actors that could not be fetched yet
+	stored, err := c.store.GetRemoteActor(ctx, actor)
+	if err == nil && !stored.FetchedAt.IsZero() {
+		person, err := types.LoadAsRawApObj([]byte(stored.Document))
+		if err == nil {
+			if time.Since(stored.FetchedAt) < remoteActorMaxAge {
+				c.cachePerson(actor, person)
+				return person, nil
+			}
+
+			// an outdated copy still beats failing
+			fresh, err := c.fetchPerson(ctx, actor, execEntity)
+			if err != nil {
+				log.Printf("apclient/fetchPerson %v: using stored copy: %v", actor, err)
+				return person, nil
+			}
+			return fresh, nil
 		}
+	}
 
-		prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
-		digestAlgorithm := httpsig.DigestSha256
-		headersToSign := []string{httpsig.RequestTarget, "date", "host"}
-		signer, _, err := httpsig.NewSigner(prefs, digestAlgorithm, headersToSign, httpsig.Signature, 0)
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
-		err = signer.SignRequest(priv, "https://"+c.config.FQDN+"/ap/acct/"+execEntity.ID+"#main-key", req, nil)
-		if err != nil {
-			log.Println(err)
-			return nil, err
+	return c.fetchPerson(ctx, actor, execEntity)
+}
+
+// RefetchPerson fetches a person bypassing the cache and refreshes the cached copy.
+// It is used when a cached key no longer verifies, e.g. after a key rotation.
+func (c ApClient) RefetchPerson(ctx context.Context, actor string, execEntity *types.ApEntity) (*types.RawApObj, error) {
+	ctx, span := tracer.Start(ctx, "RefetchPerson")
+	defer span.End()
+
+	actor = documentURL(actor)
+
+	// forged signatures must not make us hammer the remote server
+	if c.mc != nil {
+		err := c.cacheAdd(&memcache.Item{
+			Key:        "refetch:" + actor,
+			Value:      []byte{1},
+			Expiration: 60,
+		})
+		if err == memcache.ErrNotStored {
+			return nil, fmt.Errorf("recently refetched: %s", actor)
 		}
+	} else if stored, err := c.store.GetRemoteActor(ctx, actor); err == nil && time.Since(stored.FetchedAt) < time.Minute {
+		return nil, fmt.Errorf("recently refetched: %s", actor)
 	}
 
-	resp, err := client.Do(req)
+	return c.fetchPerson(ctx, actor, execEntity)
+}
+
+// RefreshPerson fetches a person from the remote server and updates the stored copy.
+func (c ApClient) RefreshPerson(ctx context.Context, actor string, execEntity *types.ApEntity) (*types.RawApObj, error) {
+	ctx, span := tracer.Start(ctx, "RefreshPerson")
+	defer span.End()
+
+	return c.fetchPerson(ctx, documentURL(actor), execEntity)
+}
+
+func (c ApClient) fetchPerson(ctx context.Context, actor string, execEntity *types.ApEntity) (*types.RawApObj, error) {
+	resp, err := c.do(ctx, "GET", actor, nil, execEntity)
 	if err != nil {
+		log.Println(err)
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -156,72 +167,70 @@ func (c ApClient) FetchPerson(ctx context.Context, actor string, execEntity *typ
 		return person, err
 	}
 
-	// cache
-	personBytes, err := json.Marshal(person.GetData())
-	if err == nil {
-		c.mc.Set(&memcache.Item{
-			Key:        actor,
-			Value:      personBytes,
-			Expiration: 1800, // 30 minutes
-		})
+	// a server may only speak for actors on its own origin
+	if id := person.MustGetString("id"); id != "" && (!sameOrigin(id, actor) || !sameOrigin(id, resp.Request.URL.String())) {
+		return nil, fmt.Errorf("%s returned an actor of another origin: %s", actor, id)
 	}
 
-	return person, nil
-}
-
-// ResolveActor resolves an actor from id notation.
-func ResolveActor(ctx context.Context, id string) (string, error) {
-	_, span := tracer.Start(ctx, "ResolveActor")
-	defer span.End()
-
-	if id[0] == '@' {
-		id = id[1:]
+	// FEP-844e: remember servers that advertise RFC 9421 support
+	for _, implements := range person.MustGetRawSlice("generator.implements") {
+		if implements.MustGetString("href") == rfc9421Spec {
+			c.advertiseRFC9421(resp.Request.URL.Host)
+		}
 	}
 
-	split := strings.Split(id, "@")
-	if len(split) != 2 {
-		return "", fmt.Errorf("invalid id")
+	if person.MustGetString("id") != "" && person.MustGetString("inbox") != "" {
+		err = c.saveRemoteActor(ctx, actor, person)
+		if err != nil {
+			log.Printf("apclient/fetchPerson %v saveRemoteActor: %v", actor, err)
+		}
 	}
 
-	domain := split[1]
+	c.cachePerson(actor, person)
 
-	targetlink := "https://" + domain + "/.well-known/webfinger?resource=acct:" + id
+	return person, nil
+}
 
-	var webfinger types.WebFinger
-	req, err := http.NewRequest("GET", targetlink, nil)
-	if err != nil {
-		return "", err
-	}
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	req.Header.Set("Accept", "application/jrd+json")
-	req.Header.Set("User-Agent", UserAgent)
-	client := new(http.Client)
-	resp, err := client.Do(req)
+// cachePerson keeps the person in memcache under the requested URL and,
+// when it is served from the same origin, under its id.
+func (c ApClient) cachePerson(actor string, person *types.RawApObj) {
+	personBytes, err := json.Marshal(person.GetData())
 	if err != nil {
-		return "", err
+		return
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 
-	err = json.Unmarshal(body, &webfinger)
-	if err != nil {
-		fmt.Println(string(body))
-		return "", err
+	c.cacheSet(&memcache.Item{
+		Key:        actor,
+		Value:      personBytes,
+		Expiration: 1800, // 30 minutes
+	})
+	// the id is claimed by the document itself; any other origin could poison the entry
+	if id := person.MustGetString("id"); id != "" && id != actor && sameOrigin(id, actor) {
+		c.cacheSet(&memcache.Item{
+			Key:        id,
+			Value:      personBytes,
+			Expiration: 1800,
+		})
 	}
+}
 
-	var aplink types.WebFingerLink
-	for _, link := range webfinger.Links {
-		if link.Rel == "self" {
-			aplink = link
-		}
-	}
+// documentURL drops the fragment of an actor or key id.
+func documentURL(id string) string {
+	document, _, _ := strings.Cut(id, "#")
+	return document
+}
 
-	if aplink.Href == "" {
-		return "", fmt.Errorf("no ap link found")
+// sameOrigin reports whether a and b share the scheme and host.
+func sameOrigin(a, b string) bool {
+	ua, err := url.Parse(a)
+	if err != nil || ua.Host == "" {
+		return false
 	}
-
-	return aplink.Href, nil
+	ub, err := url.Parse(b)
+	if err != nil || ub.Host == "" {
+		return false
+	}
+	return ua.Scheme == ub.Scheme && strings.EqualFold(ua.Host, ub.Host)
 }
 
 // PostToInbox posts a message to remote ap server.
@@ -232,50 +241,67 @@ func (c ApClient) PostToInbox(ctx context.Context, inbox string, object interfac
 		return err
 	}
 
-	req, err := http.NewRequest("POST", inbox, bytes.NewBuffer(objectBytes))
-	if err != nil {
-		return err
-	}
-	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
-	req.Header.Set("Content-Type", "application/activity+json")
-	req.Header.Set("User-Agent", UserAgent)
-	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
-	req.Header.Set("Host", req.URL.Host)
-	client := new(http.Client)
-
-	priv, err := c.store.LoadKey(ctx, entity)
+	resp, err := c.do(ctx, "POST", inbox, objectBytes, &entity)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
+	defer resp.Body.Close()
 
-	prefs := []httpsig.Algorithm{httpsig.RSA_SHA256}
-	digestAlgorithm := httpsig.DigestSha256
-	headersToSign := []string{httpsig.RequestTarget, "date", "digest", "host"}
-	signer, _, err := httpsig.NewSigner(prefs, digestAlgorithm, headersToSign, httpsig.Signature, 0)
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		log.Println(err)
-		return err
 	}
-	err = signer.SignRequest(priv, "https://"+c.config.FQDN+"/ap/acct/"+entity.ID+"#main-key", req, objectBytes)
+	log.Printf("POST %s [%d]: %s", inbox, resp.StatusCode, string(body))
 
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Println(err)
-		return err
+	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
+		return fmt.Errorf("error posting to inbox: %d", resp.StatusCode)
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return nil
+}
+
+// InstanceActor returns the bridge-wide actor, creating it on first use.
+// It is stored as a disabled entity whose ID is the FQDN, so it is served at /ap/acct/{fqdn}.
+func (c ApClient) InstanceActor(ctx context.Context) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "InstanceActor")
+	defer span.End()
+
+	entity, err := c.store.GetEntityByID(ctx, c.config.FQDN)
+	if err == nil {
+		return c.store.EnsureEd25519Key(ctx, entity)
+	}
+
+	pubKeyPEM, privKeyPEM, err := store.GenerateKeyPair()
 	if err != nil {
-		log.Println(err)
+		span.RecordError(err)
+		return types.ApEntity{}, err
 	}
-	log.Printf("POST %s [%d]: %s", inbox, resp.StatusCode, string(body))
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 400 {
-		return fmt.Errorf("error posting to inbox: %d", resp.StatusCode)
+	edPubKeyPEM, edPrivKeyPEM, err := store.GenerateEd25519KeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
 	}
 
-	defer resp.Body.Close()
+	entity, err = c.store.CreateEntity(ctx, types.ApEntity{
+		ID:                c.config.FQDN,
+		Publickey:         pubKeyPEM,
+		Privatekey:        privKeyPEM,
+		Ed25519Publickey:  edPubKeyPEM,
+		Ed25519Privatekey: edPrivKeyPEM,
+	})
+	if err != nil {
+		// another replica may have created it concurrently
+		existing, getErr := c.store.GetEntityByID(ctx, c.config.FQDN)
+		if getErr == nil {
+			return existing, nil
+		}
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
 
-	return nil
+	// the instance actor must not be picked up by the delivery workers
+	entity.Enabled = false
+	return c.store.UpdateEntity(ctx, entity)
 }
@@ -0,0 +1,41 @@
+package apclient
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// DeliverToFollowers posts an activity of the entity to the inboxes of all its followers.
+func (c ApClient) DeliverToFollowers(ctx context.Context, object any, entity types.ApEntity) error {
+	ctx, span := tracer.Start(ctx, "DeliverToFollowers")
+	defer span.End()
+
+	followers, err := c.store.GetFollowers(ctx, entity.ID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	destinations := make(map[string]bool)
+	for _, follower := range followers {
+		destinations[follower.SubscriberInbox] = true
+	}
+
+	var wg sync.WaitGroup
+	for destination := range destinations {
+		wg.Add(1)
+		go func(destination string) {
+			defer wg.Done()
+			err := c.PostToInbox(ctx, destination, object, entity)
+			if err != nil {
+				log.Printf("apclient/deliver/%v PostToInbox %v %v", entity.ID, destination, err)
+			}
+		}(destination)
+	}
+	wg.Wait()
+
+	return nil
+}
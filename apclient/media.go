@@ -0,0 +1,144 @@
+package apclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+const mediaTypeCacheExpiration = 24 * 60 * 60 // 1 day
+
+// MediaType returns the MIME type of the image at imageURL.
+// It is inferred from the extension when possible and sniffed from the first bytes otherwise.
+func (c ApClient) MediaType(ctx context.Context, imageURL string) string {
+	ctx, span := tracer.Start(ctx, "MediaType")
+	defer span.End()
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "image/png"
+	}
+
+	if mediaType := mime.TypeByExtension(strings.ToLower(path.Ext(u.Path))); strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+
+	cacheKey := "mediatype:" + imageURL
+	if len(cacheKey) > 250 {
+		cacheKey = ""
+	}
+	if cacheKey != "" {
+		if item, err := c.cacheGet(cacheKey); err == nil {
+			return string(item.Value)
+		}
+	}
+
+	// a failed sniff is cached as well so that the actor does not change with every retry
+	mediaType := sniffMediaType(ctx, imageURL)
+	if mediaType == "" {
+		mediaType = "image/png"
+	}
+
+	if cacheKey != "" {
+		c.cacheSet(&memcache.Item{
+			Key:        cacheKey,
+			Value:      []byte(mediaType),
+			Expiration: mediaTypeCacheExpiration,
+		})
+	}
+
+	return mediaType
+}
+
+// mediaClient fetches URLs taken from user content, so it only connects to public addresses.
+var mediaClient = &http.Client{
+	Timeout: 5 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 3 * time.Second,
+			Control: publicAddressOnly,
+		}).DialContext,
+		TLSHandshakeTimeout:    3 * time.Second,
+		ResponseHeaderTimeout:  3 * time.Second,
+		MaxResponseHeaderBytes: 16 << 10,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return errors.New("too many redirects")
+		}
+		return nil
+	},
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which netip does not treat as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddressOnly refuses connections to loopback, private, link-local and other non-public addresses.
+// It runs after name resolution, so it also covers hosts that resolve to internal addresses.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	addr = addr.Unmap()
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("refusing to connect to %s", addr)
+	}
+	return nil
+}
+
+func sniffMediaType(ctx context.Context, imageURL string) string {
+	u, err := url.Parse(imageURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return ""
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", imageURL, nil)
+	if err != nil {
+		return ""
+	}
+	req.Header.Set("Range", "bytes=0-511")
+
+	resp, err := mediaClient.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return ""
+	}
+
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil && strings.HasPrefix(mediaType, "image/") {
+		return mediaType
+	}
+
+	head, err := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if err != nil {
+		return ""
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !strings.HasPrefix(mediaType, "image/") {
+		return ""
+	}
+	return mediaType
+}
@@ -0,0 +1,35 @@
+package apclient
+
+import (
+	"context"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/store"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// SignObject attaches a FEP-8b32 integrity proof made with the entity's Ed25519 key.
+func (c ApClient) SignObject(ctx context.Context, object any, entity types.ApEntity) (map[string]any, error) {
+	ctx, span := tracer.Start(ctx, "SignObject")
+	defer span.End()
+
+	entity, err := c.store.EnsureEd25519Key(ctx, entity)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	priv, err := c.store.LoadEd25519Key(ctx, entity)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	document, err := signature.ToMap(object)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	return signature.AddProof(document, priv, "https://"+c.config.FQDN+"/ap/acct/"+entity.ID+store.Ed25519KeyFragment(entity.KeyVersion))
+}
@@ -0,0 +1,52 @@
+package apclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// remoteActorMaxAge is how long a stored actor is used without going remote.
+const remoteActorMaxAge = 24 * time.Hour
+
+// saveRemoteActor records the person fetched from actor in the remote_actors table.
+// The row is keyed by the URL it was fetched from, not by the id the document claims.
+func (c ApClient) saveRemoteActor(ctx context.Context, actor string, person *types.RawApObj) error {
+	id := person.MustGetString("id")
+	if !sameOrigin(id, actor) {
+		return fmt.Errorf("%s claims %s", actor, id)
+	}
+
+	document, err := json.Marshal(person.GetData())
+	if err != nil {
+		return err
+	}
+
+	handle := ""
+	if u, err := url.Parse(actor); err == nil && person.MustGetString("preferredUsername") != "" {
+		handle = person.MustGetString("preferredUsername") + "@" + u.Host
+	}
+
+	sharedInbox := person.MustGetString("endpoints.sharedInbox")
+	if sharedInbox == "" {
+		sharedInbox = person.MustGetString("sharedInbox")
+	}
+
+	now := time.Now()
+	return c.store.UpsertRemoteActor(ctx, types.RemoteActor{
+		ID:            actor,
+		URL:           person.MustGetString("url"),
+		Handle:        handle,
+		Inbox:         person.MustGetString("inbox"),
+		SharedInbox:   sharedInbox,
+		KeyID:         person.MustGetString("publicKey.id"),
+		PublicKeyPem:  person.MustGetString("publicKey.publicKeyPem"),
+		Document:      string(document),
+		FetchedAt:     now,
+		LastAttemptAt: now,
+	})
+}
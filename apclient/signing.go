@@ -0,0 +1,236 @@
+package apclient
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/totegamma/httpsig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/store"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const (
+	schemeCavage  = "cavage"
+	schemeRFC9421 = "rfc9421"
+
+	// the remote advertised RFC 9421 but we have not confirmed it yet
+	schemeRFC9421Advertised = "rfc9421-advertised"
+
+	rfc9421Spec = "https://datatracker.ietf.org/doc/html/rfc9421"
+
+	schemeCacheExpiration = 7 * 24 * 60 * 60 // 7 days
+)
+
+func schemeCacheKey(host string) string {
+	return "sigscheme:" + host
+}
+
+func ed25519CacheKey(host string) string {
+	return "sigalg-ed25519:" + host
+}
+
+// signatureSchemes returns the signature schemes to try against host, in order.
+func (c ApClient) signatureSchemes(host string) []string {
+	item, err := c.cacheGet(schemeCacheKey(host))
+	if err != nil {
+		return []string{schemeCavage, schemeRFC9421}
+	}
+
+	switch string(item.Value) {
+	case schemeRFC9421, schemeRFC9421Advertised:
+		return []string{schemeRFC9421, schemeCavage}
+	case schemeCavage:
+		return []string{schemeCavage}
+	default:
+		return []string{schemeCavage, schemeRFC9421}
+	}
+}
+
+func (c ApClient) rememberScheme(host, scheme string) {
+	c.cacheSet(&memcache.Item{
+		Key:        schemeCacheKey(host),
+		Value:      []byte(scheme),
+		Expiration: schemeCacheExpiration,
+	})
+}
+
+// advertiseRFC9421 marks host as RFC 9421 capable unless we already know better.
+func (c ApClient) advertiseRFC9421(host string) {
+	c.cacheAdd(&memcache.Item{
+		Key:        schemeCacheKey(host),
+		Value:      []byte(schemeRFC9421Advertised),
+		Expiration: schemeCacheExpiration,
+	})
+}
+
+// acceptsAlg reports whether an Accept-Signature header asks for signatures with alg.
+func acceptsAlg(acceptSignature []string, alg string) bool {
+	for _, value := range acceptSignature {
+		if strings.Contains(value, `alg="`+alg+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// rememberAcceptSignature records what host asked for in its Accept-Signature header.
+func (c ApClient) rememberAcceptSignature(host string, acceptSignature []string) {
+	c.advertiseRFC9421(host)
+	if acceptsAlg(acceptSignature, signature.AlgEd25519) {
+		c.cacheSet(&memcache.Item{
+			Key:        ed25519CacheKey(host),
+			Value:      []byte(signature.AlgEd25519),
+			Expiration: schemeCacheExpiration,
+		})
+	}
+}
+
+// acceptsEd25519 reports whether host asked for Ed25519 signatures.
+func (c ApClient) acceptsEd25519(host string) bool {
+	_, err := c.cacheGet(ed25519CacheKey(host))
+	return err == nil
+}
+
+func newRequest(ctx context.Context, method, target string, body []byte) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/activity+json")
+	} else {
+		req.Header.Set("Accept", "application/activity+json")
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	req.Header.Set("User-Agent", UserAgent)
+	req.Header.Set("Host", req.URL.Host)
+
+	return req, nil
+}
+
+// do sends a request signed by entity.
+// When the remote rejects the signature, the request is retried with the other scheme
+// and the scheme that worked is remembered per host (double-knocking).
+func (c ApClient) do(ctx context.Context, method, target string, body []byte, entity *types.ApEntity) (*http.Response, error) {
+	client := new(http.Client)
+
+	if entity == nil {
+		req, err := newRequest(ctx, method, target, body)
+		if err != nil {
+			return nil, err
+		}
+		return client.Do(req)
+	}
+
+	priv, err := c.store.LoadKey(ctx, *entity)
+	if err != nil {
+		return nil, err
+	}
+	keyID := "https://" + c.config.FQDN + "/ap/acct/" + entity.ID + store.KeyFragment(entity.KeyVersion)
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+
+	schemes := c.signatureSchemes(u.Host)
+	for i, scheme := range schemes {
+		req, err := newRequest(ctx, method, target, body)
+		if err != nil {
+			return nil, err
+		}
+
+		switch scheme {
+		case schemeRFC9421:
+			// Mastodon only verifies rsa-v1_5-sha256, so the Ed25519 key is kept for servers that ask for it
+			var signer crypto.Signer = priv
+			signerKeyID := keyID
+			if c.acceptsEd25519(u.Host) {
+				edPriv, edErr := c.store.LoadEd25519Key(ctx, *entity)
+				if edErr == nil {
+					signer = edPriv
+					signerKeyID = "https://" + c.config.FQDN + "/ap/acct/" + entity.ID + store.Ed25519KeyFragment(entity.KeyVersion)
+				}
+			}
+			err = signature.Sign(req, body, signerKeyID, signer)
+		default:
+			headersToSign := []string{httpsig.RequestTarget, "date", "host"}
+			if body != nil {
+				headersToSign = []string{httpsig.RequestTarget, "date", "digest", "host"}
+			}
+			var signer httpsig.Signer
+			signer, _, err = httpsig.NewSigner([]httpsig.Algorithm{httpsig.RSA_SHA256}, httpsig.DigestSha256, headersToSign, httpsig.Signature, 0)
+			if err == nil {
+				err = signer.SignRequest(priv, keyID, req, body)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if acceptSignature := resp.Header.Values("Accept-Signature"); len(acceptSignature) > 0 {
+			c.rememberAcceptSignature(u.Host, acceptSignature)
+		}
+
+		rejected := signatureRejected(resp)
+		if rejected && i < len(schemes)-1 {
+			log.Printf("%s %s [%d] with %s signature, retrying", method, target, resp.StatusCode, scheme)
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			continue
+		}
+
+		// a plain cavage success says nothing about RFC 9421 support, so only remember knocks
+		if !rejected && (scheme == schemeRFC9421 || i > 0) {
+			c.rememberScheme(u.Host, scheme)
+		}
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("no signature scheme for %s", u.Host)
+}
+
+// signatureRejected reports whether the response rejects the signature of the request.
+// 401 always does; 400 and 403 only when the body says so, since they are also used for
+// plain refusals that another signature scheme would not change.
+func signatureRejected(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusBadRequest, http.StatusForbidden:
+	default:
+		return false
+	}
+
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+
+	return bytes.Contains(bytes.ToLower(head), []byte("signature"))
+}
@@ -0,0 +1,74 @@
+package apclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/store"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+func TestAcceptsAlg(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []string
+		want   bool
+	}{
+		{"ed25519", []string{`sig1=("@method" "@target-uri");alg="ed25519"`}, true},
+		{"rsa", []string{`sig1=("@method" "@target-uri");alg="rsa-v1_5-sha256"`}, false},
+		{"second value", []string{`sig1=("@method");alg="rsa-v1_5-sha256"`, `sig2=("@method");alg="ed25519"`}, true},
+		{"no alg", []string{`sig1=("@method" "@target-uri")`}, false},
+		{"none", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acceptsAlg(tt.header, signature.AlgEd25519); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoSignsRFC9421WithRSA(t *testing.T) {
+	pubKeyPEM, privKeyPEM, err := store.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edPrivKeyPEM, err := store.GenerateEd25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity := types.ApEntity{ID: "alice", Publickey: pubKeyPEM, Privatekey: privKeyPEM, Ed25519Privatekey: edPrivKeyPEM}
+
+	// reject cavage signatures so that the request is retried with RFC 9421
+	var input string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		input = r.Header.Get("Signature-Input")
+		if input == "" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := ApClient{store: store.NewStore(nil, nil), config: types.ApConfig{FQDN: "example.com"}}
+	resp, err := c.do(context.Background(), http.MethodPost, server.URL+"/inbox", []byte(`{"type":"Follow"}`), &entity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+	want := `keyid="https://example.com/ap/acct/alice` + store.KeyFragment(0) + `";alg="` + signature.AlgRsaV15Sha256 + `"`
+	if !strings.Contains(input, want) {
+		t.Fatalf("Signature-Input %s lacks %s", input, want)
+	}
+}
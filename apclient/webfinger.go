@@ -0,0 +1,270 @@
+package apclient
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const (
+	webfingerCacheExpiration         = 24 * 60 * 60 // 1 day
+	webfingerNegativeCacheExpiration = 10 * 60      // 10 minutes
+	hostMetaCacheExpiration          = 24 * 60 * 60 // 1 day
+)
+
+// ErrActorNotFound is returned when the remote server has no actor for the given id.
+var ErrActorNotFound = fmt.Errorf("actor not found")
+
+func webfingerCacheKey(resource string) string {
+	return "webfinger:" + resource
+}
+
+func hostMetaCacheKey(host string) string {
+	return "hostmeta:" + host
+}
+
+// NormalizeResource turns the ways users write a remote account into a WebFinger resource and its host.
+// "@user@host", "user@host" and "acct:user@host" become "acct:user@host", profile URLs are kept as is.
+func NormalizeResource(id string) (string, string, error) {
+	id = strings.TrimSpace(id)
+
+	if strings.HasPrefix(id, "https://") || strings.HasPrefix(id, "http://") {
+		u, err := url.Parse(id)
+		if err != nil || u.Host == "" {
+			return "", "", fmt.Errorf("invalid id")
+		}
+		u.Host = strings.ToLower(u.Host)
+		u.Fragment = ""
+		return u.String(), u.Host, nil
+	}
+
+	id = strings.TrimPrefix(id, "acct:")
+	id = strings.TrimPrefix(id, "@")
+
+	split := strings.Split(id, "@")
+	if len(split) != 2 || split[0] == "" || split[1] == "" {
+		return "", "", fmt.Errorf("invalid id")
+	}
+
+	host := strings.ToLower(split[1])
+	return "acct:" + split[0] + "@" + host, host, nil
+}
+
+// ResolveActor resolves an actor from id notation or a profile URL.
+// Results are cached, and so are misses for a shorter while.
+func (c ApClient) ResolveActor(ctx context.Context, id string) (string, error) {
+	ctx, span := tracer.Start(ctx, "ResolveActor")
+	defer span.End()
+
+	resource, host, err := NormalizeResource(id)
+	if err != nil {
+		return "", err
+	}
+
+	cacheKey := webfingerCacheKey(resource)
+	if len(cacheKey) > 250 || strings.ContainsAny(cacheKey, " \t\r\n") {
+		cacheKey = ""
+	}
+
+	if cacheKey != "" {
+		if item, err := c.cacheGet(cacheKey); err == nil {
+			if len(item.Value) == 0 {
+				return "", ErrActorNotFound
+			}
+			return string(item.Value), nil
+		}
+	}
+
+	actor, err := c.webfinger(ctx, resource, "https://"+host+"/.well-known/webfinger?resource={uri}")
+	if err != nil {
+		// the account domain may delegate WebFinger to another host
+		template, lrddErr := c.lrddTemplate(ctx, host)
+		if lrddErr == nil && template != "https://"+host+"/.well-known/webfinger?resource={uri}" {
+			actor, err = c.webfinger(ctx, resource, template)
+		}
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		// transport failures are not worth remembering
+		if err == ErrActorNotFound && cacheKey != "" {
+			c.cacheSet(&memcache.Item{
+				Key:        cacheKey,
+				Value:      []byte{},
+				Expiration: webfingerNegativeCacheExpiration,
+			})
+		}
+		return "", err
+	}
+
+	if cacheKey != "" {
+		c.cacheSet(&memcache.Item{
+			Key:        cacheKey,
+			Value:      []byte(actor),
+			Expiration: webfingerCacheExpiration,
+		})
+	}
+
+	return actor, nil
+}
+
+// webfinger queries the endpoint given by template and returns the ActivityPub self link.
+func (c ApClient) webfinger(ctx context.Context, resource, template string) (string, error) {
+	target := strings.ReplaceAll(template, "{uri}", url.QueryEscape(resource))
+
+	resp, err := getWellKnown(ctx, target, "application/jrd+json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return "", ErrActorNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("webfinger %s: %s", target, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	var webfinger types.WebFinger
+	err = json.Unmarshal(body, &webfinger)
+	if err != nil {
+		return "", ErrActorNotFound
+	}
+
+	var href string
+	for _, link := range webfinger.Links {
+		if link.Rel != "self" {
+			continue
+		}
+		if link.Type == "application/activity+json" || strings.HasPrefix(link.Type, "application/ld+json") {
+			return link.Href, nil
+		}
+		if href == "" {
+			href = link.Href
+		}
+	}
+
+	if href == "" {
+		return "", ErrActorNotFound
+	}
+
+	return href, nil
+}
+
+type hostMeta struct {
+	Links []struct {
+		Rel      string `xml:"rel,attr"`
+		Template string `xml:"template,attr"`
+	} `xml:"Link"`
+}
+
+// lrddTemplate discovers the WebFinger endpoint of host from its host-meta.
+func (c ApClient) lrddTemplate(ctx context.Context, host string) (string, error) {
+	cacheKey := hostMetaCacheKey(host)
+	if item, err := c.cacheGet(cacheKey); err == nil {
+		if len(item.Value) == 0 {
+			return "", fmt.Errorf("no lrdd template for %s", host)
+		}
+		return string(item.Value), nil
+	}
+
+	template, err := fetchLrddTemplate(ctx, host)
+	if err != nil {
+		c.cacheSet(&memcache.Item{
+			Key:        cacheKey,
+			Value:      []byte{},
+			Expiration: webfingerNegativeCacheExpiration,
+		})
+		return "", err
+	}
+
+	c.cacheSet(&memcache.Item{
+		Key:        cacheKey,
+		Value:      []byte(template),
+		Expiration: hostMetaCacheExpiration,
+	})
+
+	return template, nil
+}
+
+func fetchLrddTemplate(ctx context.Context, host string) (string, error) {
+	resp, err := getWellKnown(ctx, "https://"+host+"/.well-known/host-meta", "application/xrd+xml")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("host-meta %s: %s", host, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+
+	var meta hostMeta
+	err = xml.Unmarshal(body, &meta)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range meta.Links {
+		if link.Rel == "lrdd" && strings.HasPrefix(link.Template, "https://") && strings.Contains(link.Template, "{uri}") {
+			return link.Template, nil
+		}
+	}
+
+	return "", fmt.Errorf("no lrdd template for %s", host)
+}
+
+func getWellKnown(ctx context.Context, target, accept string) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	req.Header.Set("Accept", accept)
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// cancelOnClose releases the request context once the body has been read.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
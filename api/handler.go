@@ -1,6 +1,7 @@
 package api
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"net/url"
@@ -8,7 +9,6 @@ import (
 	"github.com/labstack/echo/v4"
 	"go.opentelemetry.io/otel"
 
-	"github.com/concrnt/ccworld-ap-bridge/types"
 	"github.com/concrnt/concrnt/core"
 )
 
@@ -139,6 +139,10 @@ func (h Handler) CreateEntity(c echo.Context) error {
 	}
 
 	entity, err := h.service.CreateEntity(ctx, requester, request.ID)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
 
 	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": entity})
 }
@@ -248,7 +252,8 @@ func (h Handler) UpdateUserSettings(c echo.Context) error {
 		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
 	}
 
-	var settings types.ApUserSettings
+	// fields left out of the request keep their stored value; settings are optional
+	settings, _ := h.service.GetUserSettings(ctx, requester)
 	err := c.Bind(&settings)
 	if err != nil {
 		span.RecordError(err)
@@ -284,3 +289,173 @@ func (h Handler) GetUserSettings(c echo.Context) error {
 
 	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": settings})
 }
+
+// ReportRequest is a struct for a request to report remote content.
+type ReportRequest struct {
+	Target  string `json:"target"`
+	Comment string `json:"comment"`
+}
+
+// Report handles reports of remote content to its home instance.
+func (h Handler) Report(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.Report")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	var request ReportRequest
+	err := c.Bind(&request)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if request.Target == "" {
+		return c.String(http.StatusBadRequest, "Invalid target")
+	}
+
+	flag, err := h.service.Report(ctx, requester, request.Target, request.Comment)
+	if err != nil {
+		span.RecordError(err)
+		switch {
+		case errors.Is(err, ErrReportTargetNotFound):
+			return c.String(http.StatusNotFound, "target not found")
+		case errors.Is(err, ErrReportTargetLocal):
+			return c.String(http.StatusBadRequest, "local content cannot be reported to a remote server")
+		case errors.Is(err, ErrReportDelivery):
+			return c.String(http.StatusBadGateway, "failed to deliver the report")
+		default:
+			return c.String(http.StatusInternalServerError, "internal server error")
+		}
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": flag})
+}
+
+func (h Handler) RotateKey(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.RotateKey")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	entity, err := h.service.GetEntityByCCID(ctx, requester)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	rotated, err := h.service.RotateKey(ctx, entity.ID)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusInternalServerError, "Internal server error: "+err.Error())
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": rotated})
+}
+
+// CreateSubprofileRequest is a struct for a request to publish a subprofile as its own actor.
+type CreateSubprofileRequest struct {
+	ProfileID string `json:"profileID"`
+	Name      string `json:"name"`
+}
+
+func (h Handler) CreateSubprofileEntity(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.CreateSubprofileEntity")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	var request CreateSubprofileRequest
+	err := c.Bind(&request)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+
+	if request.ProfileID == "" || request.Name == "" {
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+
+	entity, err := h.service.CreateSubprofileEntity(ctx, requester, request.ProfileID, request.Name)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": entity})
+}
+
+type CreateGroupRequest struct {
+	TimelineID string `json:"timelineID"`
+}
+
+// CreateGroupEntity opts a community timeline of the requester in as a Group actor.
+func (h Handler) CreateGroupEntity(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.CreateGroupEntity")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	var request CreateGroupRequest
+	err := c.Bind(&request)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, "Invalid request body")
+	}
+
+	entity, err := h.service.CreateGroupEntity(ctx, requester, request.TimelineID)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": entity})
+}
+
+func (h Handler) GetSubprofileEntities(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.GetSubprofileEntities")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	entities, err := h.service.GetSubprofileEntities(ctx, requester)
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok", "content": entities})
+}
+
+func (h Handler) DeleteSubprofileEntity(c echo.Context) error {
+	ctx, span := tracer.Start(c.Request().Context(), "Api.Service.DeleteSubprofileEntity")
+	defer span.End()
+
+	requester, ok := ctx.Value(core.RequesterIdCtxKey).(string)
+	if !ok {
+		return c.JSON(http.StatusForbidden, echo.Map{"status": "error", "message": "requester not found"})
+	}
+
+	err := h.service.DeleteSubprofileEntity(ctx, requester, c.Param("id"))
+	if err != nil {
+		span.RecordError(err)
+		return c.String(http.StatusNotFound, "entity not found")
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{"status": "ok"})
+}
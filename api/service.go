@@ -2,13 +2,17 @@ package api
 
 import (
 	"context"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"log"
+	"regexp"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 
 	"github.com/concrnt/concrnt/client"
 	"github.com/concrnt/concrnt/core"
@@ -21,6 +25,7 @@ import (
 )
 
 type Service struct {
+	rdb      *redis.Client
 	store    *store.Store
 	client   client.Client
 	apclient *apclient.ApClient
@@ -29,6 +34,7 @@ type Service struct {
 }
 
 func NewService(
+	rdb *redis.Client,
 	store *store.Store,
 	client client.Client,
 	apclient *apclient.ApClient,
@@ -36,6 +42,7 @@ func NewService(
 	config types.ApConfig,
 ) *Service {
 	return &Service{
+		rdb,
 		store,
 		client,
 		apclient,
@@ -54,7 +61,23 @@ func (s *Service) UpdateEntityAliases(ctx context.Context, requester string, ali
 		return types.ApEntity{}, err
 	}
 
-	return s.store.UpdateEntityAliases(ctx, entity.ID, aliases)
+	updated, err := s.store.UpdateEntityAliases(ctx, entity.ID, aliases)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	s.profileChanged(ctx, requester)
+
+	return updated, nil
+}
+
+// profileChanged asks the profile worker to compare the actors of the user.
+func (s *Service) profileChanged(ctx context.Context, ccid string) {
+	err := s.rdb.Publish(ctx, types.ProfileChannel, ccid).Err()
+	if err != nil {
+		log.Printf("api/profile/%v Publish %v", ccid, err)
+	}
 }
 
 func (s *Service) Follow(ctx context.Context, requester, targetID string) (types.ApFollow, error) {
@@ -67,7 +90,7 @@ func (s *Service) Follow(ctx context.Context, requester, targetID string) (types
 		return types.ApFollow{}, err
 	}
 
-	targetActor, err := apclient.ResolveActor(ctx, targetID)
+	targetActor, err := s.apclient.ResolveActor(ctx, targetID)
 	if err != nil {
 		log.Println("resolve actor error", err)
 		span.RecordError(err)
@@ -131,7 +154,7 @@ func (s *Service) UnFollow(ctx context.Context, requester, targetID string) (typ
 	followID := "https://" + s.config.FQDN + "/follow/" + entity.ID + "/" + simpleID
 	log.Println("unfollow", followID)
 
-	targetActor, err := apclient.ResolveActor(ctx, targetID)
+	targetActor, err := s.apclient.ResolveActor(ctx, targetID)
 	if err != nil {
 		span.RecordError(err)
 		return types.ApFollow{}, err
@@ -180,6 +203,12 @@ func (s *Service) UnFollow(ctx context.Context, requester, targetID string) (typ
 	return deleted, nil
 }
 
+// validEntityID reports whether a user may claim id. Timeline ids belong to Group actors,
+// dotted ids to subprofiles and the FQDN to the instance actor.
+func validEntityID(id, fqdn string) bool {
+	return id != "" && id != fqdn && !strings.Contains(id, ".") && !bridge.IsTimelineID(id)
+}
+
 func (s *Service) CreateEntity(ctx context.Context, requester string, id string) (types.ApEntity, error) {
 	ctx, span := tracer.Start(ctx, "Api.Service.CreateEntity")
 	defer span.End()
@@ -189,42 +218,35 @@ func (s *Service) CreateEntity(ctx context.Context, requester string, id string)
 	if err == nil { // Already exists
 
 		entity.Privatekey = ""
+		entity.Ed25519Privatekey = ""
 		return entity, nil
 
 	} else { // Create
 
+		if !validEntityID(id, s.config.FQDN) {
+			return types.ApEntity{}, errors.New("invalid id")
+		}
+
 		// RSAキーペアの生成
-		privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		pubKeyPEM, privKeyPEM, err := store.GenerateKeyPair()
 		if err != nil {
-			panic(err)
+			span.RecordError(err)
+			return types.ApEntity{}, err
 		}
 
-		// 秘密鍵をPEM形式に変換
-		privKeyBytes := x509.MarshalPKCS1PrivateKey(privKey)
-		privKeyPEM := pem.EncodeToMemory(
-			&pem.Block{
-				Type:  "RSA PRIVATE KEY",
-				Bytes: privKeyBytes,
-			},
-		)
-
-		// 公開鍵をPEM形式に変換
-		pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+		edPubKeyPEM, edPrivKeyPEM, err := store.GenerateEd25519KeyPair()
 		if err != nil {
-			panic(err)
+			span.RecordError(err)
+			return types.ApEntity{}, err
 		}
-		pubKeyPEM := pem.EncodeToMemory(
-			&pem.Block{
-				Type:  "PUBLIC KEY",
-				Bytes: pubKeyBytes,
-			},
-		)
 
 		created, err := s.store.CreateEntity(ctx, types.ApEntity{
-			ID:         id,
-			CCID:       requester,
-			Publickey:  string(pubKeyPEM),
-			Privatekey: string(privKeyPEM),
+			ID:                id,
+			CCID:              requester,
+			Publickey:         pubKeyPEM,
+			Privatekey:        privKeyPEM,
+			Ed25519Publickey:  edPubKeyPEM,
+			Ed25519Privatekey: edPrivKeyPEM,
 		})
 		if err != nil {
 			span.RecordError(err)
@@ -232,6 +254,7 @@ func (s *Service) CreateEntity(ctx context.Context, requester string, id string)
 		}
 
 		created.Privatekey = ""
+		created.Ed25519Privatekey = ""
 		return created, nil
 	}
 }
@@ -247,6 +270,7 @@ func (s *Service) GetEntityByID(ctx context.Context, id string) (types.ApEntity,
 	}
 
 	entity.Privatekey = ""
+	entity.Ed25519Privatekey = ""
 
 	return entity, nil
 }
@@ -262,6 +286,7 @@ func (s *Service) GetEntityByCCID(ctx context.Context, ccid string) (types.ApEnt
 	}
 
 	entity.Privatekey = ""
+	entity.Ed25519Privatekey = ""
 
 	return entity, nil
 }
@@ -315,7 +340,7 @@ func (s *Service) ResolvePerson(ctx context.Context, id, requester string) (any,
 	}
 
 	if !strings.HasPrefix(id, "https://") {
-		id, err = apclient.ResolveActor(ctx, id)
+		id, err = s.apclient.ResolveActor(ctx, id)
 		if err != nil {
 			span.RecordError(err)
 			return nil, err
@@ -390,7 +415,59 @@ func (s *Service) UpsertUserSettings(ctx context.Context, settings types.ApUserS
 	ctx, span := tracer.Start(ctx, "Api.Service.UpsertUserSettings")
 	defer span.End()
 
-	return s.store.UpsertUserSettings(ctx, settings)
+	// settings are optional
+	previous, _ := s.store.GetUserSettings(ctx, settings.CCID)
+
+	pinned := []string{}
+	for _, messageID := range settings.PinnedMessages {
+		if slices.Contains(pinned, messageID) {
+			continue
+		}
+		if !slices.Contains(previous.PinnedMessages, messageID) {
+			_, err := s.bridge.PinnedEntity(ctx, settings.CCID, messageID)
+			if err != nil {
+				span.RecordError(err)
+				return err
+			}
+		}
+		pinned = append(pinned, messageID)
+	}
+	settings.PinnedMessages = pinned
+
+	err := s.store.UpsertUserSettings(ctx, settings)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	// followers are told about the changed pins by the worker
+	var changes []types.FeaturedChange
+	for _, messageID := range settings.PinnedMessages {
+		if !slices.Contains(previous.PinnedMessages, messageID) {
+			changes = append(changes, types.FeaturedChange{CCID: settings.CCID, Type: "Add", MessageID: messageID})
+		}
+	}
+	for _, messageID := range previous.PinnedMessages {
+		if !slices.Contains(settings.PinnedMessages, messageID) {
+			changes = append(changes, types.FeaturedChange{CCID: settings.CCID, Type: "Remove", MessageID: messageID})
+		}
+	}
+	for _, change := range changes {
+		changeBytes, err := json.Marshal(change)
+		if err != nil {
+			span.RecordError(err)
+			return err
+		}
+		err = s.rdb.LPush(ctx, types.FeaturedQueue, changeBytes).Err()
+		if err != nil {
+			span.RecordError(err)
+			return errors.Wrap(err, "queue featured change")
+		}
+	}
+
+	s.profileChanged(ctx, settings.CCID)
+
+	return nil
 }
 
 func (s *Service) GetUserSettings(ctx context.Context, requester string) (types.ApUserSettings, error) {
@@ -399,3 +476,297 @@ func (s *Service) GetUserSettings(ctx context.Context, requester string) (types.
 
 	return s.store.GetUserSettings(ctx, requester)
 }
+
+var (
+	// ErrReportTargetNotFound is returned when the reported content was never bridged.
+	ErrReportTargetNotFound = errors.New("report target not found")
+	// ErrReportTargetLocal is returned when the reported content is our own.
+	ErrReportTargetLocal = errors.New("report target is local")
+	// ErrReportDelivery is returned when the home instance of the reported content could not be reached.
+	ErrReportDelivery = errors.New("report delivery failed")
+)
+
+// Report sends a Flag activity for a bridged remote note to its home instance.
+// target is either the concrnt message ID of the bridged note or the ActivityPub object URL.
+func (s *Service) Report(ctx context.Context, requester, target, comment string) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Api.Service.Report")
+	defer span.End()
+
+	local := "https://" + s.config.FQDN + "/"
+	if strings.HasPrefix(target, local) {
+		return types.ApObject{}, ErrReportTargetLocal
+	}
+
+	var ref types.ApObjectReference
+	var err error
+	if strings.HasPrefix(target, "https://") {
+		ref, err = s.store.GetApObjectReferenceByApObjectID(ctx, target)
+	} else {
+		ref, err = s.store.GetApObjectReferenceByCcObjectID(ctx, target)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return types.ApObject{}, errors.Wrap(ErrReportTargetNotFound, target)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, errors.Wrap(err, "GetApObjectReference")
+	}
+	if strings.HasPrefix(ref.ApObjectID, local) {
+		return types.ApObject{}, ErrReportTargetLocal
+	}
+
+	instanceActor, err := s.apclient.InstanceActor(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	note, err := s.apclient.FetchNote(ctx, ref.ApObjectID, instanceActor)
+	if errors.Is(err, apclient.ErrObjectNotFound) {
+		return types.ApObject{}, errors.Wrap(ErrReportTargetNotFound, ref.ApObjectID)
+	}
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, errors.Wrap(ErrReportDelivery, "FetchNote: "+err.Error())
+	}
+
+	noteID := note.MustGetString("id")
+	if noteID == "" {
+		noteID = ref.ApObjectID
+	}
+
+	actor := note.MustGetString("attributedTo")
+	if actor == "" {
+		actor = note.MustGetString("actor")
+	}
+	if actor == "" {
+		return types.ApObject{}, errors.Wrap(ErrReportDelivery, noteID+" has no actor")
+	}
+
+	person, err := s.apclient.FetchPerson(ctx, actor, &instanceActor)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, errors.Wrap(ErrReportDelivery, "FetchPerson: "+err.Error())
+	}
+
+	inbox := person.MustGetString("endpoints.sharedInbox")
+	if inbox == "" {
+		inbox = person.MustGetString("inbox")
+	}
+
+	flag := types.ApObject{
+		Context: "https://www.w3.org/ns/activitystreams",
+		Type:    "Flag",
+		ID:      "https://" + s.config.FQDN + "/ap/flag/" + uuid.New().String(),
+		Actor:   "https://" + s.config.FQDN + "/ap/acct/" + instanceActor.ID,
+		Content: comment,
+		Object:  []string{person.MustGetString("id"), noteID},
+	}
+
+	err = s.apclient.PostToInbox(ctx, inbox, flag, instanceActor)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, errors.Wrap(ErrReportDelivery, "PostToInbox: "+err.Error())
+	}
+
+	return flag, nil
+}
+
+// RotateKey replaces the key pairs of the entity and tells its followers to refresh the actor.
+func (s *Service) RotateKey(ctx context.Context, id string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Api.Service.RotateKey")
+	defer span.End()
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	grace := 7 * 24 * time.Hour
+	if s.config.KeyGrace > 0 {
+		grace = time.Duration(s.config.KeyGrace) * time.Second
+	}
+
+	rotated, err := s.store.RotateKey(ctx, entity, grace)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "RotateKey")
+	}
+
+	person, err := s.bridge.EntityToPerson(ctx, rotated)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "EntityToPerson")
+	}
+
+	err = s.apclient.DeliverToFollowers(ctx, s.bridge.PersonUpdate(person), rotated)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "DeliverToFollowers")
+	}
+
+	rotated.Privatekey = ""
+	rotated.Ed25519Privatekey = ""
+	return rotated, nil
+}
+
+// CreateGroupEntity opts a public community timeline of the requester in as a Group actor.
+func (s *Service) CreateGroupEntity(ctx context.Context, requester, timelineID string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Api.Service.CreateGroupEntity")
+	defer span.End()
+
+	entity, err := s.bridge.CreateGroupEntity(ctx, requester, timelineID)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	entity.Privatekey = ""
+	entity.Ed25519Privatekey = ""
+	return entity, nil
+}
+
+var subprofileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+// CreateSubprofileEntity opts a subprofile of the requester in as its own actor, e.g. alice.character.
+func (s *Service) CreateSubprofileEntity(ctx context.Context, requester, profileID, name string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Api.Service.CreateSubprofileEntity")
+	defer span.End()
+
+	if !subprofileNamePattern.MatchString(name) {
+		return types.ApEntity{}, errors.New("invalid name")
+	}
+
+	parent, err := s.store.GetEntityByCCID(ctx, requester)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "entity not found")
+	}
+
+	existing, err := s.store.GetSubprofileEntity(ctx, parent.ID, profileID)
+	if err == nil {
+		existing.Privatekey = ""
+		existing.Ed25519Privatekey = ""
+		return existing, nil
+	}
+
+	mainProfile, err := s.client.GetProfile(ctx, requester+"/world.concrnt.p", &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "GetProfile")
+	}
+
+	var mainProfileDocument core.ProfileDocument[world.Profile]
+	err = json.Unmarshal([]byte(mainProfile.Document), &mainProfileDocument)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "json.Unmarshal")
+	}
+
+	if mainProfileDocument.Body.Subprofiles == nil || !slices.Contains(*mainProfileDocument.Body.Subprofiles, profileID) {
+		return types.ApEntity{}, errors.New("not a subprofile of the requester")
+	}
+
+	profile, err := s.client.GetProfile(ctx, profileID, &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, errors.Wrap(err, "GetProfile")
+	}
+	if profile.Author != requester {
+		return types.ApEntity{}, errors.New("not a subprofile of the requester")
+	}
+
+	pubKeyPEM, privKeyPEM, err := store.GenerateKeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	edPubKeyPEM, edPrivKeyPEM, err := store.GenerateEd25519KeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	created, err := s.store.CreateEntity(ctx, types.ApEntity{
+		ID:                parent.ID + "." + name,
+		CCID:              requester,
+		Publickey:         pubKeyPEM,
+		Privatekey:        privKeyPEM,
+		Ed25519Publickey:  edPubKeyPEM,
+		Ed25519Privatekey: edPrivKeyPEM,
+		ParentID:          parent.ID,
+		ProfileID:         profileID,
+	})
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	created.Privatekey = ""
+	created.Ed25519Privatekey = ""
+	return created, nil
+}
+
+// GetSubprofileEntities lists the subprofile actors of the requester.
+func (s *Service) GetSubprofileEntities(ctx context.Context, requester string) ([]types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Api.Service.GetSubprofileEntities")
+	defer span.End()
+
+	parent, err := s.store.GetEntityByCCID(ctx, requester)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	entities, err := s.store.GetSubprofileEntities(ctx, parent.ID)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	for i := range entities {
+		entities[i].Privatekey = ""
+		entities[i].Ed25519Privatekey = ""
+	}
+
+	return entities, nil
+}
+
+// DeleteSubprofileEntity opts a subprofile actor of the requester out again.
+func (s *Service) DeleteSubprofileEntity(ctx context.Context, requester, id string) error {
+	ctx, span := tracer.Start(ctx, "Api.Service.DeleteSubprofileEntity")
+	defer span.End()
+
+	parent, err := s.store.GetEntityByCCID(ctx, requester)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	entity, err := s.store.GetEntityByID(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	if entity.ParentID != parent.ID {
+		return errors.New("not a subprofile of the requester")
+	}
+
+	// followers are told while the actor can still sign
+	err = s.apclient.DeliverToFollowers(ctx, s.bridge.PersonDelete(entity), entity)
+	if err != nil {
+		span.RecordError(err)
+		return errors.Wrap(err, "DeliverToFollowers")
+	}
+
+	err = s.store.DeleteEntity(ctx, entity.ID)
+	if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package api
+
+import "testing"
+
+func TestValidEntityID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{"alice", true},
+		{"tom", true},
+		{"t0000000000000000000000000x", true},
+		{"", false},
+		{"example.com", false},
+		{"alice.character", false},
+		{"t0000000000000000000000000", false},
+		{"tgdnbfq3z51km6xmz0678m0r9x", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := validEntityID(tt.id, "example.com"); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
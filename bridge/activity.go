@@ -0,0 +1,34 @@
+package bridge
+
+import (
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// NoteToActivity wraps a note built by MessageToNote into the activity its actor publishes,
+// addressed to the same audience as the note.
+func (s Service) NoteToActivity(messageID string, note types.ApObject, actorID string) types.ApObject {
+	if note.Type == "Announce" {
+		return types.ApObject{
+			Context:   []string{"https://www.w3.org/ns/activitystreams"},
+			Type:      "Announce",
+			ID:        "https://" + s.config.FQDN + "/ap/note/" + messageID + "/activity",
+			Actor:     "https://" + s.config.FQDN + "/ap/acct/" + actorID,
+			Content:   "",
+			Object:    note.Object,
+			Published: note.Published,
+			To:        note.To,
+			CC:        note.CC,
+		}
+	}
+
+	return types.ApObject{
+		Context:   []string{"https://www.w3.org/ns/activitystreams"},
+		Type:      "Create",
+		ID:        "https://" + s.config.FQDN + "/ap/note/" + messageID + "/activity",
+		Actor:     "https://" + s.config.FQDN + "/ap/acct/" + actorID,
+		Published: note.Published,
+		To:        note.To,
+		CC:        note.CC,
+		Object:    note,
+	}
+}
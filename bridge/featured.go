@@ -0,0 +1,85 @@
+package bridge
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// FeaturedNotes returns the pinned notes of the entity in the order the user pinned them.
+// Pins of the same user posted from another of their actors are left to that actor's collection.
+func (s Service) FeaturedNotes(ctx context.Context, entity types.ApEntity) []types.ApObject {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.FeaturedNotes")
+	defer span.End()
+
+	notes := []types.ApObject{}
+	if entity.CCID == "" {
+		return notes
+	}
+
+	// settings are optional
+	settings, _ := s.store.GetUserSettings(ctx, entity.CCID)
+
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+	for _, messageID := range settings.PinnedMessages {
+		note, err := s.MessageToNote(ctx, messageID)
+		if err != nil {
+			continue
+		}
+		if note.Type != "Note" || note.AttributedTo != actor || !Fetchable(note) {
+			continue
+		}
+		note.Context = nil
+		notes = append(notes, note)
+	}
+
+	return notes
+}
+
+// FeaturedActivity builds the Add or Remove activity announcing a change to the featured collection of actorID.
+func (s Service) FeaturedActivity(activityType, messageID, actorID string) types.ApObject {
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + actorID
+	return types.ApObject{
+		Context: []string{"https://www.w3.org/ns/activitystreams"},
+		Type:    activityType,
+		ID:      actor + "#featured/" + messageID + "/" + strconv.FormatInt(time.Now().Unix(), 10),
+		Actor:   actor,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		Object:  "https://" + s.config.FQDN + "/ap/note/" + messageID,
+		Target:  actor + "/collections/featured",
+	}
+}
+
+// PinnedEntity returns the entity whose actor published the message, which must be a public or unlisted note
+// of the requester.
+func (s Service) PinnedEntity(ctx context.Context, requester, messageID string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.PinnedEntity")
+	defer span.End()
+
+	note, err := s.MessageToNote(ctx, messageID)
+	if err != nil {
+		return types.ApEntity{}, errors.Wrap(err, "pinned message "+messageID)
+	}
+	if note.Type != "Note" {
+		return types.ApEntity{}, errors.New("pinned message " + messageID + " is not a note")
+	}
+	// followers-only and direct notes are left out of the featured collection, so pinning them announces nothing
+	if !Fetchable(note) {
+		return types.ApEntity{}, errors.New("pinned message " + messageID + " is not public")
+	}
+
+	entity, err := s.store.GetEntityByID(ctx, strings.TrimPrefix(note.AttributedTo, "https://"+s.config.FQDN+"/ap/acct/"))
+	if err != nil {
+		return types.ApEntity{}, errors.Wrap(err, "pinned message "+messageID)
+	}
+	if entity.CCID != requester {
+		return types.ApEntity{}, errors.New("pinned message " + messageID + " is not owned by the requester")
+	}
+
+	return entity, nil
+}
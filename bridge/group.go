@@ -0,0 +1,222 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/concrnt/ccworld-ap-bridge/store"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+)
+
+// communityTimeline fetches a public community timeline hosted on this server.
+func (s Service) communityTimeline(ctx context.Context, timelineID string) (core.Timeline, core.TimelineDocument[world.CommunityTimeline], error) {
+	var document core.TimelineDocument[world.CommunityTimeline]
+
+	timeline, err := s.client.GetTimeline(ctx, timelineID+"@"+s.config.FQDN, &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		return timeline, document, err
+	}
+
+	if timeline.Schema != world.CommunityTimelineSchema || !timeline.Indexable {
+		return timeline, document, errors.New("not a public community timeline")
+	}
+
+	err = json.Unmarshal([]byte(timeline.Document), &document)
+	return timeline, document, err
+}
+
+var timelineIDPattern = regexp.MustCompile(`^t[0-9A-Za-z]{25}$`)
+
+// IsTimelineID reports whether id has the shape of a Concrnt timeline id, the namespace of Group actors.
+func IsTimelineID(id string) bool {
+	return timelineIDPattern.MatchString(id)
+}
+
+// CreateGroupEntity opts a public community timeline of the requester in as a Group actor.
+func (s Service) CreateGroupEntity(ctx context.Context, requester, timelineID string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.CreateGroupEntity")
+	defer span.End()
+
+	if !IsTimelineID(timelineID) {
+		return types.ApEntity{}, errors.New("not a timeline")
+	}
+
+	entity, err := s.store.GetEntityByID(ctx, timelineID)
+	if err == nil {
+		if entity.TimelineID == "" {
+			return types.ApEntity{}, errors.New("not a group")
+		}
+		return entity, nil
+	}
+
+	timeline, _, err := s.communityTimeline(ctx, timelineID)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	if timeline.Owner != requester && timeline.Author != requester {
+		return types.ApEntity{}, errors.New("not the owner of the timeline")
+	}
+
+	pubKeyPEM, privKeyPEM, err := store.GenerateKeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	edPubKeyPEM, edPrivKeyPEM, err := store.GenerateEd25519KeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	entity, err = s.store.CreateEntity(ctx, types.ApEntity{
+		ID:                timelineID,
+		Publickey:         pubKeyPEM,
+		Privatekey:        privKeyPEM,
+		Ed25519Publickey:  edPubKeyPEM,
+		Ed25519Privatekey: edPrivKeyPEM,
+		TimelineID:        timeline.ID,
+	})
+	if err != nil {
+		span.RecordError(err)
+		return types.ApEntity{}, err
+	}
+
+	return entity, nil
+}
+
+// EntityToGroup builds the FEP-1b12 Group actor of a community timeline.
+func (s Service) EntityToGroup(ctx context.Context, entity types.ApEntity) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.EntityToGroup")
+	defer span.End()
+
+	timeline, document, err := s.communityTimeline(ctx, entity.TimelineID)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	assertionMethod, err := s.AssertionMethod(entity)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	var icon *types.Icon
+	if document.Body.Icon != "" {
+		icon = &types.Icon{
+			Type:      "Image",
+			MediaType: s.apclient.MediaType(ctx, document.Body.Icon),
+			URL:       document.Body.Icon,
+		}
+	}
+
+	var image *types.Icon
+	if document.Body.Banner != "" {
+		image = &types.Icon{
+			Type:      "Image",
+			MediaType: s.apclient.MediaType(ctx, document.Body.Banner),
+			URL:       document.Body.Banner,
+		}
+	}
+
+	id := entity.ID
+	discoverable := true
+	return types.ApObject{
+		Context: []string{
+			"https://www.w3.org/ns/activitystreams",
+			"https://w3id.org/security/v1",
+			"https://w3id.org/security/multikey/v1",
+		},
+		Type:        "Group",
+		ID:          "https://" + s.config.FQDN + "/ap/acct/" + id,
+		Inbox:       "https://" + s.config.FQDN + "/ap/acct/" + id + "/inbox",
+		Outbox:      "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox",
+		Followers:   "https://" + s.config.FQDN + "/ap/acct/" + id + "/followers",
+		SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
+		Endpoints: &types.PersonEndpoints{
+			SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
+		},
+		PreferredUsername: id,
+		Name:              document.Body.Name,
+		Summary:           document.Body.Description,
+		URL:               "https://concrnt.world/timeline/" + timeline.ID + "@" + s.config.FQDN,
+		Icon:              icon,
+		Image:             image,
+		Published:         timeline.CDate.UTC().Format(time.RFC3339),
+		Discoverable:      &discoverable,
+		PublicKey:         s.PublicKey(entity),
+		AssertionMethod:   assertionMethod,
+	}, nil
+}
+
+// GroupAnnounce builds the FEP-1b12 Announce a Group publishes for a post of its timeline.
+// Posts of bridged users are announced as their Create activity. Posts that came from the fediverse
+// are announced by the id of their original object, since only their author can publish the Create.
+func (s Service) GroupAnnounce(ctx context.Context, group types.ApEntity, messageID string, published time.Time) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.GroupAnnounce")
+	defer span.End()
+
+	var object any
+	ref, err := s.store.GetApObjectReferenceByCcObjectID(ctx, messageID)
+	if err == nil && ref.ApObjectID != "" {
+		object = ref.ApObjectID
+	} else {
+		note, err := s.MessageToNote(ctx, messageID)
+		if err != nil {
+			span.RecordError(err)
+			return types.ApObject{}, errors.Wrap(err, "MessageToNote")
+		}
+		if note.Type != "Note" || !Fetchable(note) {
+			return types.ApObject{}, errors.New("message " + messageID + " is not a public note")
+		}
+
+		actorID := strings.TrimPrefix(note.AttributedTo, "https://"+s.config.FQDN+"/ap/acct/")
+		activity := s.NoteToActivity(messageID, note, actorID)
+		activity.Context = nil
+		object = activity
+	}
+
+	return types.ApObject{
+		Context:   []string{"https://www.w3.org/ns/activitystreams"},
+		Type:      "Announce",
+		ID:        "https://" + s.config.FQDN + "/ap/acct/" + group.ID + "/announces/" + messageID,
+		Actor:     "https://" + s.config.FQDN + "/ap/acct/" + group.ID,
+		Published: published.UTC().Format(time.RFC3339),
+		To:        []string{"https://www.w3.org/ns/activitystreams#Public"},
+		CC:        []string{"https://" + s.config.FQDN + "/ap/acct/" + group.ID + "/followers"},
+		Object:    object,
+	}, nil
+}
+
+// GroupDeleteAnnounce builds the Announce a Group publishes when a post of a bridged user leaves its timeline.
+// Concrnt messages cannot be edited, so there is no Update to announce.
+func (s Service) GroupDeleteAnnounce(group types.ApEntity, messageID, actorID string) types.ApObject {
+	return types.ApObject{
+		Context: []string{"https://www.w3.org/ns/activitystreams"},
+		Type:    "Announce",
+		ID:      "https://" + s.config.FQDN + "/ap/acct/" + group.ID + "/announces/" + messageID + "/delete",
+		Actor:   "https://" + s.config.FQDN + "/ap/acct/" + group.ID,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		CC:      []string{"https://" + s.config.FQDN + "/ap/acct/" + group.ID + "/followers"},
+		Object: types.ApObject{
+			Type:  "Delete",
+			ID:    "https://" + s.config.FQDN + "/ap/note/" + messageID + "/delete",
+			Actor: "https://" + s.config.FQDN + "/ap/acct/" + actorID,
+			Object: types.ApObject{
+				Type: "Tombstone",
+				ID:   "https://" + s.config.FQDN + "/ap/note/" + messageID,
+			},
+		},
+	}
+}
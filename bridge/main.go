@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/url"
 	"regexp"
 	"slices"
@@ -136,6 +137,9 @@ func (s Service) NoteToMessage(ctx context.Context, object *types.RawApObj, pers
 		}
 	}
 
+	mentions := s.localMentions(ctx, object)
+	content = s.rewriteMentions(content, mentions)
+
 	if len(content) > 4096 {
 		content = content[:4096]
 	}
@@ -170,12 +174,19 @@ func (s Service) NoteToMessage(ctx context.Context, object *types.RawApObj, pers
 
 	visibility := "unknown"
 	participants := []string{}
+	directRecipients := []string{}
 
-	if slices.Contains(to, "https://www.w3.org/ns/activitystreams#Public") || slices.Contains(cc, "https://www.w3.org/ns/activitystreams#Public") {
+	if slices.Contains(to, "https://www.w3.org/ns/activitystreams#Public") {
 		visibility = "public"
 		goto CHECK_VISIBILITY
 	}
 
+	// Public only in cc is Mastodon's "unlisted"; clients keep these out of public timelines
+	if slices.Contains(cc, "https://www.w3.org/ns/activitystreams#Public") {
+		visibility = "unlisted"
+		goto CHECK_VISIBILITY
+	}
+
 	for _, v := range to {
 		if strings.HasSuffix(v, "/followers") {
 			visibility = "followers"
@@ -191,33 +202,52 @@ func (s Service) NoteToMessage(ctx context.Context, object *types.RawApObj, pers
 					fmt.Println("entity not found", err)
 					continue
 				}
-				participants = append(participants, entity.CCID)
+				if !slices.Contains(participants, entity.CCID) {
+					participants = append(participants, entity.CCID)
+				}
 			}
 		}
+	}
 
-		if strings.HasPrefix(v, "https://"+s.config.FQDN+"/ap/acct/") {
-			visibility = "direct"
-			entity, err := s.store.GetEntityByID(ctx, strings.TrimPrefix(v, "https://"+s.config.FQDN+"/ap/acct/"))
-			if err != nil {
-				fmt.Println("entity not found")
-				continue
+	// every bridged user addressed takes part, not only the first one
+	for _, v := range append(to, cc...) {
+		if !strings.HasPrefix(v, "https://"+s.config.FQDN+"/ap/acct/") {
+			continue
+		}
+		entity, err := s.store.GetEntityByID(ctx, strings.TrimPrefix(v, "https://"+s.config.FQDN+"/ap/acct/"))
+		if err != nil {
+			if visibility == "unknown" {
+				visibility = "direct"
 			}
+			log.Printf("bridge/NoteToMessage recipient %v GetEntityByID %v", v, err)
+			continue
+		}
+		if entity.TimelineID != "" {
+			// addressing a Group does not make the post direct
+			continue
+		}
+		if visibility == "unknown" {
+			visibility = "direct"
+		}
+		if !slices.Contains(participants, entity.CCID) {
 			participants = append(participants, entity.CCID)
-			break
+		}
+		if visibility == "direct" {
+			directRecipients = append(directRecipients, entity.CCID)
 		}
 	}
 CHECK_VISIBILITY:
 
 	if visibility == "unknown" {
 		return core.Message{}, errors.New("invalid to")
-	} else if visibility != "public" && len(participants) == 0 {
+	} else if visibility != "public" && visibility != "unlisted" && len(participants) == 0 {
 		return core.Message{}, errors.New("invalid to")
 	}
 
 	var policy = ""
 	var policyParams = ""
 	if len(participants) > 0 {
-		policy = "https://policy.concrnt.world/m/whisper.json"
+		policy = world.WhisperPolicyURL
 		params := world.WhisperPolicy{
 			Participants: participants,
 		}
@@ -229,6 +259,34 @@ CHECK_VISIBILITY:
 		policyParams = string(policyParamsBytes)
 	}
 
+	// direct messages show up in the notifications of every bridged recipient
+	for _, ccid := range directRecipients {
+		notify := world.UserNotifyStream + "@" + ccid
+		if !slices.Contains(destStreams, notify) {
+			destStreams = append(destStreams, notify)
+		}
+	}
+
+	// remote actors of a direct thread, so replies from Concrnt can address all of them again
+	apParticipants := []string{}
+	if visibility == "direct" {
+		for _, v := range append(to, cc...) {
+			if strings.HasPrefix(v, "https://"+s.config.FQDN+"/") || strings.HasSuffix(v, "/followers") {
+				continue
+			}
+			if !slices.Contains(apParticipants, v) {
+				apParticipants = append(apParticipants, v)
+			}
+		}
+		actor := object.MustGetString("attributedTo")
+		if actor == "" {
+			actor = person.MustGetString("id")
+		}
+		if actor != "" && !slices.Contains(apParticipants, actor) {
+			apParticipants = append(apParticipants, actor)
+		}
+	}
+
 	var document []byte
 
 	var ReplyToMessageID string
@@ -282,6 +340,7 @@ CHECK_VISIBILITY:
 					"apObjectRef":      object.MustGetString("id"),
 					"apPublisherInbox": person.MustGetString("inbox"),
 					"visibility":       visibility,
+					"apParticipants":   apParticipants,
 				},
 				SignedAt:     date,
 				Policy:       policy,
@@ -339,6 +398,7 @@ CHECK_VISIBILITY:
 					"apObjectRef":      object.MustGetString("id"),
 					"apPublisherInbox": person.MustGetString("inbox"),
 					"visibility":       visibility,
+					"apParticipants":   apParticipants,
 				},
 				SignedAt:     date,
 				Policy:       policy,
@@ -394,6 +454,7 @@ CHECK_VISIBILITY:
 						"apObjectRef":      object.MustGetString("id"),
 						"apPublisherInbox": person.MustGetString("inbox"),
 						"visibility":       visibility,
+						"apParticipants":   apParticipants,
 					},
 					SignedAt:     date,
 					Policy:       policy,
@@ -437,6 +498,7 @@ CHECK_VISIBILITY:
 						"apObjectRef":      object.MustGetString("id"),
 						"apPublisherInbox": person.MustGetString("inbox"),
 						"visibility":       visibility,
+						"apParticipants":   apParticipants,
 					},
 					SignedAt:     date,
 					Policy:       policy,
@@ -541,36 +603,30 @@ CHECK_VISIBILITY:
 	}
 
 	if len(assDocument) > 0 {
-		signatureBytes, err := core.SignBytes(assDocument, s.config.ProxyPriv)
+		err = s.commitAssociation(ctx, assDocument)
 		if err != nil {
-			return core.Message{}, errors.Wrap(err, "sign error")
-		}
-
-		signature := hex.EncodeToString(signatureBytes)
-
-		opt := commitStore.CommitOption{
-			IsEphemeral: true,
-		}
-
-		option, err := json.Marshal(opt)
-		if err != nil {
-			return core.Message{}, errors.Wrap(err, "json marshal error")
+			return core.Message{}, err
 		}
+	}
 
-		commitObj := core.Commit{
-			Document:  string(assDocument),
-			Signature: string(signature),
-			Option:    string(option),
+	// mentioned users are notified unless the reply or the direct message already reached them
+	for _, entity := range mentions {
+		if entity.CCID == ReplyToMessageAuthor || entity.CCID == RerouteMessageAuthor || slices.Contains(directRecipients, entity.CCID) {
+			continue
 		}
 
-		commit, err := json.Marshal(commitObj)
+		mentionDocument, err := s.mentionAssociation(created.Content, entity.CCID, &world.ProfileOverride{
+			Username: username,
+			Avatar:   person.MustGetString("icon.url"),
+			Link:     object.MustGetString("actor"),
+		}, date)
 		if err != nil {
-			return core.Message{}, errors.Wrap(err, "json marshal error")
+			return core.Message{}, err
 		}
 
-		_, err = s.client.Commit(ctx, s.config.FQDN, string(commit), &core.Association{}, nil)
+		err = s.commitAssociation(ctx, mentionDocument)
 		if err != nil {
-			return core.Message{}, err
+			log.Printf("bridge/mention/%v commitAssociation %v", entity.ID, err)
 		}
 	}
 
@@ -599,11 +655,30 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 		return types.ApObject{}, errors.New("invalid payload")
 	}
 
+	// messages posted as a character come from its own actor when the user opted it in
+	if document.Body.ProfileOverride != nil && document.Body.ProfileOverride.CharacterID != "" {
+		characterEntity, err := s.store.GetSubprofileEntity(ctx, authorEntity.ID, document.Body.ProfileOverride.CharacterID)
+		if err == nil {
+			authorEntity = characterEntity
+		}
+	}
+
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + authorEntity.ID
+	visibility, recipients := s.messageVisibility(ctx, message, authorEntity)
+
 	images := []string{}
 	tags := []types.Tag{}
 
 	text := document.Body.Body
 
+	text, mentionTags, mentioned := s.outboundMentions(ctx, text, document.Body.Mentions)
+	tags = append(tags, mentionTags...)
+	for _, actor := range mentioned {
+		if !slices.Contains(recipients, actor) {
+			recipients = append(recipients, actor)
+		}
+	}
+
 	// extract image url of markdown notation
 	imagePattern := regexp.MustCompile(`!\[[^]]*\]\(([^)]*)\)`)
 	matches := imagePattern.FindAllStringSubmatch(text, -1)
@@ -715,6 +790,8 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 
 	if document.Schema == world.MarkdownMessageSchema || document.Schema == world.MediaMessageSchema { // Note
 
+		to, cc := audience(visibility, actor, recipients)
+
 		return types.ApObject{
 			Context: []string{
 				"https://www.w3.org/ns/activitystreams",
@@ -722,15 +799,15 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 			},
 			Type:           "Note",
 			ID:             "https://" + s.config.FQDN + "/ap/note/" + message.ID,
-			AttributedTo:   "https://" + s.config.FQDN + "/ap/acct/" + authorEntity.ID,
+			AttributedTo:   actor,
 			Summary:        summary,
 			Content:        htmlText,
 			MisskeyContent: text,
 			Published:      document.SignedAt.Format(time.RFC3339),
-			To:             []string{"https://www.w3.org/ns/activitystreams#Public"},
+			To:             to,
 			Tag:            tags,
 			Attachment:     attachments,
-			CC:             []string{},
+			CC:             cc,
 		}, nil
 
 	} else if document.Schema == world.ReplyMessageSchema { // Reply
@@ -769,16 +846,32 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 			ref = "https://" + replyAuthor.Domain + "/ap/note/" + replyDocument.Body.ReplyToMessageID
 		}
 
-		CC := []string{}
 		replyToActor, ok := replyMeta["apActor"].(string)
 		if ok {
-			CC = []string{replyToActor}
+			if !slices.Contains(recipients, replyToActor) {
+				recipients = append(recipients, replyToActor)
+			}
 			tags = append(tags, types.Tag{
 				Type: "Mention",
 				Href: replyToActor,
 			})
 		}
 
+		// replies within a direct thread stay direct and reach every remote participant
+		if replyMeta["visibility"] == VisibilityDirect {
+			visibility = VisibilityDirect
+			apParticipants, _ := replyMeta["apParticipants"].([]any)
+			for _, participant := range apParticipants {
+				participant, ok := participant.(string)
+				if !ok || participant == "" || slices.Contains(recipients, participant) {
+					continue
+				}
+				recipients = append(recipients, participant)
+			}
+		}
+
+		to, cc := audience(visibility, actor, recipients)
+
 		return types.ApObject{
 			Context: []string{
 				"https://www.w3.org/ns/activitystreams",
@@ -786,12 +879,12 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 			},
 			Type:           "Note",
 			ID:             "https://" + s.config.FQDN + "/ap/note/" + message.ID,
-			AttributedTo:   "https://" + s.config.FQDN + "/ap/acct/" + authorEntity.ID,
+			AttributedTo:   actor,
 			Content:        htmlText,
 			MisskeyContent: text,
 			InReplyTo:      ref,
-			To:             []string{"https://www.w3.org/ns/activitystreams#Public"},
-			CC:             CC,
+			To:             to,
+			CC:             cc,
 			Tag:            tags,
 			Attachment:     attachments,
 		}, nil
@@ -832,12 +925,17 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 			ref = "https://" + rerouteAuthor.Domain + "/ap/note/" + rerouteDocument.Body.RerouteMessageID
 		}
 
+		to, cc := audience(visibility, actor, recipients)
+
 		if text == "" {
 			return types.ApObject{
 				Context: "https://www.w3.org/ns/activitystreams",
 				Type:    "Announce",
 				ID:      "https://" + s.config.FQDN + "/ap/note/" + message.ID,
+				Actor:   "https://" + s.config.FQDN + "/ap/acct/" + authorEntity.ID,
 				Object:  ref,
+				To:      to,
+				CC:      cc,
 			}, nil
 		}
 
@@ -848,12 +946,12 @@ func (s Service) MessageToNote(ctx context.Context, messageID string) (types.ApO
 			},
 			Type:           "Note",
 			ID:             "https://" + s.config.FQDN + "/ap/note/" + message.ID,
-			AttributedTo:   "https://" + s.config.FQDN + "/ap/acct/" + authorEntity.ID,
+			AttributedTo:   actor,
 			Content:        htmlText,
 			MisskeyContent: text,
 			QuoteURL:       ref,
-			To:             []string{"https://www.w3.org/ns/activitystreams#Public"},
-			CC:             []string{},
+			To:             to,
+			CC:             cc,
 		}, nil
 	} else {
 		return types.ApObject{}, errors.New("invalid schema")
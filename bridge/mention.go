@@ -0,0 +1,205 @@
+package bridge
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+	commitStore "github.com/concrnt/concrnt/x/store"
+)
+
+// localMentions returns the bridged users the object mentions in its tags.
+// Characters are mentioned as the user they belong to, Groups are left out.
+func (s Service) localMentions(ctx context.Context, object *types.RawApObj) []types.ApEntity {
+	mentions := []types.ApEntity{}
+	for _, tag := range object.MustGetRawSlice("tag") {
+		if tag.MustGetString("type") != "Mention" {
+			continue
+		}
+
+		href := tag.MustGetString("href")
+		if !strings.HasPrefix(href, "https://"+s.config.FQDN+"/ap/acct/") {
+			continue
+		}
+
+		entity, err := s.store.GetEntityByID(ctx, strings.TrimPrefix(href, "https://"+s.config.FQDN+"/ap/acct/"))
+		if err != nil || entity.TimelineID != "" || entity.CCID == "" {
+			continue
+		}
+
+		if slices.ContainsFunc(mentions, func(m types.ApEntity) bool { return m.ID == entity.ID }) {
+			continue
+		}
+		mentions = append(mentions, entity)
+	}
+	return mentions
+}
+
+// rewriteMentions replaces the links and handles of mentioned bridged users with Concrnt mentions.
+func (s Service) rewriteMentions(content string, mentions []types.ApEntity) string {
+	for _, entity := range mentions {
+		actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+
+		// [@user](https://fqdn/ap/acct/user) as left by htmlToMarkdown
+		link := regexp.MustCompile(`\[@[^\]]*\]\(` + regexp.QuoteMeta(actor) + `\)`)
+		content = link.ReplaceAllLiteralString(content, "@"+entity.CCID)
+
+		// @user@fqdn in plain text and MFM
+		handle := regexp.MustCompile(`@` + regexp.QuoteMeta(entity.ID) + `@` + regexp.QuoteMeta(s.config.FQDN) + `\b`)
+		content = handle.ReplaceAllLiteralString(content, "@"+entity.CCID)
+	}
+	return content
+}
+
+// mentionAssociation builds the association that notifies a mentioned user of a bridged message.
+func (s Service) mentionAssociation(message core.Message, mentioned string, profileOverride *world.ProfileOverride, date time.Time) ([]byte, error) {
+	doc := core.AssociationDocument[world.MentionAssociation]{
+		DocumentBase: core.DocumentBase[world.MentionAssociation]{
+			Signer: s.config.ProxyCCID,
+			Owner:  mentioned,
+			Type:   "association",
+			Schema: world.MentionAssociationSchema,
+			Body: world.MentionAssociation{
+				ProfileOverride: profileOverride,
+			},
+			SignedAt: date,
+		},
+		Target:    message.ID,
+		Timelines: []string{world.UserNotifyStream + "@" + mentioned},
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "json marshal error")
+	}
+	return document, nil
+}
+
+// commitAssociation signs an association document as the proxy and commits it.
+func (s Service) commitAssociation(ctx context.Context, document []byte) error {
+	signatureBytes, err := core.SignBytes(document, s.config.ProxyPriv)
+	if err != nil {
+		return errors.Wrap(err, "sign error")
+	}
+
+	signature := hex.EncodeToString(signatureBytes)
+
+	opt := commitStore.CommitOption{
+		IsEphemeral: true,
+	}
+
+	option, err := json.Marshal(opt)
+	if err != nil {
+		return errors.Wrap(err, "json marshal error")
+	}
+
+	commitObj := core.Commit{
+		Document:  string(document),
+		Signature: string(signature),
+		Option:    string(option),
+	}
+
+	commit, err := json.Marshal(commitObj)
+	if err != nil {
+		return errors.Wrap(err, "json marshal error")
+	}
+
+	_, err = s.client.Commit(ctx, s.config.FQDN, string(commit), &core.Association{}, nil)
+	return err
+}
+
+var (
+	ccidMentionPattern   = regexp.MustCompile(`@(con1[0-9a-z]{38})\b`)
+	handleMentionPattern = regexp.MustCompile(`(^|[^\w/\[])@([\w.-]+@[\w-]+(?:\.[\w-]+)+)`)
+)
+
+// outboundMentions turns the mentions of a Concrnt message into Mention tags and the actors to address.
+// Concrnt users come from the document's mentions and @ccid notation, fediverse users from @user@host handles.
+// The returned text links every mention; Concrnt users who aren't bridged link to their web profile.
+func (s Service) outboundMentions(ctx context.Context, text string, ccids []string) (string, []types.Tag, []string) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.OutboundMentions")
+	defer span.End()
+
+	tags := []types.Tag{}
+	recipients := []string{}
+
+	mention := func(name, actor string) {
+		if slices.Contains(recipients, actor) {
+			return
+		}
+		tags = append(tags, types.Tag{
+			Type: "Mention",
+			Name: name,
+			Href: actor,
+		})
+		recipients = append(recipients, actor)
+	}
+
+	// fediverse handles, including bridged users written as @id@fqdn
+	text = handleMentionPattern.ReplaceAllStringFunc(text, func(match string) string {
+		groups := handleMentionPattern.FindStringSubmatch(match)
+		prefix, handle := groups[1], groups[2]
+
+		var actor string
+		split := strings.Split(handle, "@")
+		if split[1] == s.config.FQDN {
+			entity, err := s.store.GetEntityByID(ctx, split[0])
+			if err != nil {
+				return match
+			}
+			actor = "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+		} else {
+			var err error
+			actor, err = s.apclient.ResolveActor(ctx, handle)
+			if err != nil {
+				span.RecordError(err)
+				return match
+			}
+		}
+
+		mention("@"+handle, actor)
+		return prefix + "[@" + handle + "](" + actor + ")"
+	})
+
+	for _, match := range ccidMentionPattern.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(ccids, match[1]) {
+			ccids = append(ccids, match[1])
+		}
+	}
+
+	for _, ccid := range ccids {
+		var link string
+
+		entity, err := s.store.GetEntityByCCID(ctx, ccid)
+		if err == nil {
+			actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+			name := "@" + entity.ID + "@" + s.config.FQDN
+			mention(name, actor)
+			link = "[" + name + "](" + actor + ")"
+		} else {
+			name := "@" + ccid
+			profile, err := s.client.GetProfile(ctx, ccid+"/world.concrnt.p", &client.Options{Resolver: s.config.FQDN})
+			if err == nil {
+				var document core.ProfileDocument[world.Profile]
+				if json.Unmarshal([]byte(profile.Document), &document) == nil && document.Body.Username != "" {
+					name = "@" + document.Body.Username
+				}
+			}
+			link = "[" + name + "](https://concrnt.world/" + ccid + ")"
+		}
+
+		text = regexp.MustCompile(`@`+regexp.QuoteMeta(ccid)+`\b`).ReplaceAllLiteralString(text, link)
+	}
+
+	return text, tags, recipients
+}
@@ -0,0 +1,266 @@
+package bridge
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/concrnt/ccworld-ap-bridge/signature"
+	"github.com/concrnt/ccworld-ap-bridge/store"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+)
+
+// EntityToPerson builds the Person actor of the entity from its Concrnt profile.
+func (s Service) EntityToPerson(ctx context.Context, entity types.ApEntity) (types.ApObject, error) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.EntityToPerson")
+	defer span.End()
+
+	entity, err := s.store.EnsureEd25519Key(ctx, entity)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	assertionMethod, err := s.AssertionMethod(entity)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	// subprofile actors are rendered from their own profile
+	profileID := entity.CCID + "/world.concrnt.p"
+	if entity.ProfileID != "" {
+		profileID = entity.ProfileID
+	}
+
+	profile, err := s.client.GetProfile(ctx, profileID, &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	var profileDocument core.ProfileDocument[world.Profile]
+	err = json.Unmarshal([]byte(profile.Document), &profileDocument)
+	if err != nil {
+		span.RecordError(err)
+		return types.ApObject{}, err
+	}
+
+	// settings are optional
+	settings, _ := s.store.GetUserSettings(ctx, entity.CCID)
+
+	discoverable := true
+	if settings.Discoverable != nil {
+		discoverable = *settings.Discoverable
+	}
+
+	indexable := false
+	if settings.Indexable != nil {
+		indexable = *settings.Indexable
+	} else {
+		home, err := s.client.GetTimeline(ctx, world.UserHomeStream+"@"+entity.CCID, &client.Options{Resolver: s.config.FQDN})
+		if err == nil {
+			indexable = home.Indexable
+		}
+	}
+
+	attachments := make([]types.Attachment, 0, len(settings.ProfileFields))
+	for _, field := range settings.ProfileFields {
+		if entity.ParentID != "" {
+			break
+		}
+		attachments = append(attachments, types.Attachment{
+			Type:  "PropertyValue",
+			Name:  field.Name,
+			Value: profileFieldValue(field.Value),
+		})
+	}
+
+	var icon *types.Icon
+	if profileDocument.Body.Avatar != "" {
+		icon = &types.Icon{
+			Type:      "Image",
+			MediaType: s.apclient.MediaType(ctx, profileDocument.Body.Avatar),
+			URL:       profileDocument.Body.Avatar,
+		}
+	}
+
+	var image *types.Icon
+	if profileDocument.Body.Banner != "" {
+		image = &types.Icon{
+			Type:      "Image",
+			MediaType: s.apclient.MediaType(ctx, profileDocument.Body.Banner),
+			URL:       profileDocument.Body.Banner,
+		}
+	}
+
+	id := entity.ID
+	return types.ApObject{
+		Context: []any{
+			"https://www.w3.org/ns/activitystreams",
+			"https://w3id.org/security/v1",
+			"https://w3id.org/security/multikey/v1",
+			map[string]any{
+				"schema":        "http://schema.org#",
+				"PropertyValue": "schema:PropertyValue",
+				"value":         "schema:value",
+				"toot":          "http://joinmastodon.org/ns#",
+				"discoverable":  "toot:discoverable",
+				"indexable":     "toot:indexable",
+				"featured": map[string]string{
+					"@id":   "toot:featured",
+					"@type": "@id",
+				},
+			},
+		},
+		Type:        "Person",
+		ID:          "https://" + s.config.FQDN + "/ap/acct/" + id,
+		Inbox:       "https://" + s.config.FQDN + "/ap/acct/" + id + "/inbox",
+		Outbox:      "https://" + s.config.FQDN + "/ap/acct/" + id + "/outbox",
+		Followers:   "https://" + s.config.FQDN + "/ap/acct/" + id + "/followers",
+		Following:   "https://" + s.config.FQDN + "/ap/acct/" + id + "/following",
+		Featured:    "https://" + s.config.FQDN + "/ap/acct/" + id + "/collections/featured",
+		SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
+		Endpoints: &types.PersonEndpoints{
+			SharedInbox: "https://" + s.config.FQDN + "/ap/inbox",
+		},
+		PreferredUsername: id,
+		Name:              profileDocument.Body.Username,
+		Summary:           profileDocument.Body.Description,
+		URL:               "https://" + s.config.FQDN + "/ap/acct/" + id,
+		Icon:              icon,
+		Image:             image,
+		Attachment:        attachments,
+		Published:         profile.CDate.UTC().Format(time.RFC3339),
+		Discoverable:      &discoverable,
+		Indexable:         &indexable,
+		PublicKey:         s.PublicKey(entity),
+		AssertionMethod:   assertionMethod,
+		AlsoKnownAs:       entity.AlsoKnownAs,
+	}, nil
+}
+
+// profileFieldValue renders a profile field value as HTML the way Mastodon does, linking bare URLs.
+func profileFieldValue(value string) string {
+	if u, err := url.Parse(value); err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" {
+		display := strings.TrimPrefix(strings.TrimPrefix(value, "https://"), "http://")
+		return `<a href="` + html.EscapeString(value) + `" rel="me nofollow noopener noreferrer" target="_blank">` + html.EscapeString(display) + `</a>`
+	}
+	return html.EscapeString(value)
+}
+
+// PersonUpdate wraps the Person in an Update activity so remote servers refresh their copy.
+func (s Service) PersonUpdate(person types.ApObject) types.ApObject {
+	return types.ApObject{
+		Context: person.Context,
+		Type:    "Update",
+		ID:      person.ID + "#updates/" + strconv.FormatInt(time.Now().Unix(), 10),
+		Actor:   person.ID,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		Object:  person,
+	}
+}
+
+// PersonDelete is the Delete activity that tells remote servers an actor is gone.
+func (s Service) PersonDelete(entity types.ApEntity) types.ApObject {
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+	return types.ApObject{
+		Context: []string{"https://www.w3.org/ns/activitystreams"},
+		Type:    "Delete",
+		ID:      actor + "#delete",
+		Actor:   actor,
+		To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
+		Object:  actor,
+	}
+}
+
+// PublicKey returns the publicKey of the entity's actor.
+// While a rotated key is in its grace period both keys are listed, the current one first.
+func (s Service) PublicKey(entity types.ApEntity) any {
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+
+	current := types.Key{
+		ID:           actor + store.KeyFragment(entity.KeyVersion),
+		Type:         "Key",
+		Owner:        actor,
+		PublicKeyPem: entity.Publickey,
+	}
+
+	if entity.KeyVersion == 0 || entity.PreviousPublickey == "" || entity.PreviousKeyExpiresAt == nil || time.Now().After(*entity.PreviousKeyExpiresAt) {
+		return &current
+	}
+
+	return []types.Key{
+		current,
+		{
+			ID:           actor + store.KeyFragment(entity.KeyVersion-1),
+			Type:         "Key",
+			Owner:        actor,
+			PublicKeyPem: entity.PreviousPublickey,
+		},
+	}
+}
+
+// AssertionMethod lists the Ed25519 key of the entity as a FEP-521a Multikey.
+// While a rotated key is in its grace period the previous key is listed after the current one.
+func (s Service) AssertionMethod(entity types.ApEntity) ([]types.Multikey, error) {
+	if entity.Ed25519Publickey == "" {
+		return nil, nil
+	}
+
+	actor := "https://" + s.config.FQDN + "/ap/acct/" + entity.ID
+
+	current, err := multikey(actor, actor+store.Ed25519KeyFragment(entity.KeyVersion), entity.Ed25519Publickey)
+	if err != nil {
+		return nil, err
+	}
+	keys := []types.Multikey{current}
+
+	if entity.KeyVersion == 0 || entity.PreviousEd25519Publickey == "" || entity.PreviousKeyExpiresAt == nil || time.Now().After(*entity.PreviousKeyExpiresAt) {
+		return keys, nil
+	}
+
+	previous, err := multikey(actor, actor+store.Ed25519KeyFragment(entity.KeyVersion-1), entity.PreviousEd25519Publickey)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(keys, previous), nil
+}
+
+// multikey converts a PEM encoded Ed25519 public key into a Multikey controlled by actor.
+func multikey(actor, id, pubKeyPEM string) (types.Multikey, error) {
+	block, _ := pem.Decode([]byte(pubKeyPEM))
+	if block == nil {
+		return types.Multikey{}, errors.New("failed to parse PEM block containing the key")
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return types.Multikey{}, err
+	}
+
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return types.Multikey{}, errors.New("not an ed25519 public key")
+	}
+
+	return types.Multikey{
+		ID:                 id,
+		Type:               "Multikey",
+		Controller:         actor,
+		PublicKeyMultibase: signature.EncodeMultikey(edPub),
+	}, nil
+}
@@ -0,0 +1,191 @@
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+	"github.com/concrnt/concrnt/client"
+	"github.com/concrnt/concrnt/core"
+)
+
+const (
+	VisibilityPublic    = "public"
+	VisibilityUnlisted  = "unlisted"
+	VisibilityFollowers = "followers"
+	VisibilityDirect    = "direct"
+)
+
+const publicAddress = "https://www.w3.org/ns/activitystreams#Public"
+
+// messageVisibility decides who may see a Concrnt message on the fediverse.
+// Whispers go only to their bridged participants, messages that no publicly readable timeline carries
+// go to followers only. Public messages go out unlisted when their meta asks for it or when all their
+// public timelines are listed in the user's unlisted timelines.
+// The returned recipients are the actors addressed besides the audience.
+func (s Service) messageVisibility(ctx context.Context, message core.Message, author types.ApEntity) (string, []string) {
+	ctx, span := tracer.Start(ctx, "Bridge.Service.MessageVisibility")
+	defer span.End()
+
+	switch message.Policy {
+	case "":
+	case world.WhisperPolicyURL:
+		var whisper world.WhisperPolicy
+		if message.PolicyParams != nil {
+			err := json.Unmarshal([]byte(*message.PolicyParams), &whisper)
+			if err != nil {
+				span.RecordError(err)
+			}
+		}
+
+		recipients := []string{}
+		for _, participant := range whisper.Participants {
+			if participant == author.CCID {
+				continue
+			}
+			entity, err := s.store.GetEntityByCCID(ctx, participant)
+			if err != nil {
+				continue
+			}
+			recipients = append(recipients, "https://"+s.config.FQDN+"/ap/acct/"+entity.ID)
+		}
+		return VisibilityDirect, recipients
+	default:
+		// unknown policies may restrict readers in ways we can't express
+		return VisibilityFollowers, nil
+	}
+
+	var document core.DocumentBase[any]
+	err := json.Unmarshal([]byte(message.Document), &document)
+	if err != nil {
+		span.RecordError(err)
+	}
+	unlisted := false
+	if meta, ok := document.Meta.(map[string]any); ok {
+		unlisted = meta["visibility"] == VisibilityUnlisted
+	}
+
+	if len(message.Timelines) == 0 {
+		if unlisted {
+			return VisibilityUnlisted, nil
+		}
+		return VisibilityPublic, nil
+	}
+
+	// settings are optional
+	settings, _ := s.store.GetUserSettings(ctx, author.CCID)
+	unlistedTimelines := make([]string, 0, len(settings.UnlistedTimelines))
+	for _, timelineID := range settings.UnlistedTimelines {
+		timeline, err := s.client.GetTimeline(ctx, timelineID, &client.Options{Resolver: s.config.FQDN})
+		if err != nil {
+			continue
+		}
+		unlistedTimelines = append(unlistedTimelines, timeline.ID)
+	}
+
+	visibility := VisibilityFollowers
+	for _, timelineID := range message.Timelines {
+		timeline, ok := s.readPublicTimeline(ctx, timelineID)
+		if !ok {
+			continue
+		}
+		if unlisted || slices.Contains(unlistedTimelines, timeline.ID) {
+			visibility = VisibilityUnlisted
+			continue
+		}
+		return VisibilityPublic, nil
+	}
+
+	return visibility, nil
+}
+
+// readPublicTimeline returns the timeline if anyone may read it. Timelines that can't be resolved count as private.
+func (s Service) readPublicTimeline(ctx context.Context, timelineID string) (core.Timeline, bool) {
+	timeline, err := s.client.GetTimeline(ctx, timelineID, &client.Options{Resolver: s.config.FQDN})
+	if err != nil {
+		return core.Timeline{}, false
+	}
+
+	switch timeline.Policy {
+	case "":
+		return timeline, true
+	case world.ReadWritePolicyURL:
+		if timeline.PolicyParams == nil {
+			return core.Timeline{}, false
+		}
+		var params world.ReadWritePolicy
+		err = json.Unmarshal([]byte(*timeline.PolicyParams), &params)
+		if err != nil {
+			return core.Timeline{}, false
+		}
+		return timeline, params.IsReadPublic
+	default:
+		return core.Timeline{}, false
+	}
+}
+
+// audience returns the to and cc of an object of the actor with the given visibility.
+func audience(visibility, actor string, recipients []string) ([]string, []string) {
+	followers := actor + "/followers"
+	switch visibility {
+	case VisibilityPublic:
+		return []string{publicAddress}, append([]string{followers}, recipients...)
+	case VisibilityUnlisted:
+		return []string{followers}, append([]string{publicAddress}, recipients...)
+	case VisibilityFollowers:
+		return []string{followers}, append([]string{}, recipients...)
+	default:
+		return append([]string{}, recipients...), []string{}
+	}
+}
+
+// Visibility reads the visibility of an object back from its addressing.
+func Visibility(object types.ApObject) string {
+	to := Addresses(object.To)
+	cc := Addresses(object.CC)
+
+	if slices.Contains(to, publicAddress) {
+		return VisibilityPublic
+	}
+
+	if slices.Contains(cc, publicAddress) {
+		return VisibilityUnlisted
+	}
+
+	for _, address := range to {
+		if strings.HasSuffix(address, "/followers") {
+			return VisibilityFollowers
+		}
+	}
+
+	return VisibilityDirect
+}
+
+// Addresses returns the addresses of a to or cc field.
+func Addresses(field any) []string {
+	switch v := field.(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if address, ok := item.(string); ok {
+				result = append(result, address)
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// Fetchable reports whether an object may be served to anyone who asks for it.
+func Fetchable(object types.ApObject) bool {
+	visibility := Visibility(object)
+	return visibility == VisibilityPublic || visibility == VisibilityUnlisted
+}
@@ -0,0 +1,117 @@
+package bridge
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const testActor = "https://example.com/ap/acct/alice"
+
+func TestAudience(t *testing.T) {
+	followers := testActor + "/followers"
+	bob := "https://example.com/ap/acct/bob"
+
+	tests := []struct {
+		visibility string
+		recipients []string
+		to         []string
+		cc         []string
+	}{
+		{VisibilityPublic, nil, []string{publicAddress}, []string{followers}},
+		{VisibilityPublic, []string{bob}, []string{publicAddress}, []string{followers, bob}},
+		{VisibilityUnlisted, nil, []string{followers}, []string{publicAddress}},
+		{VisibilityFollowers, nil, []string{followers}, []string{}},
+		{VisibilityFollowers, []string{bob}, []string{followers}, []string{bob}},
+		{VisibilityDirect, []string{bob}, []string{bob}, []string{}},
+		{VisibilityDirect, nil, []string{}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.visibility, func(t *testing.T) {
+			to, cc := audience(tt.visibility, testActor, tt.recipients)
+			if !reflect.DeepEqual(to, tt.to) || !reflect.DeepEqual(cc, tt.cc) {
+				t.Fatalf("got to=%v cc=%v, want to=%v cc=%v", to, cc, tt.to, tt.cc)
+			}
+
+			// the addressing reads back as the visibility it was built from
+			if got := Visibility(types.ApObject{To: to, CC: cc}); got != tt.visibility {
+				t.Fatalf("Visibility = %s", got)
+			}
+		})
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		want   string
+	}{
+		{"public", `{"to":["https://www.w3.org/ns/activitystreams#Public"],"cc":["https://remote.example/users/bob/followers"]}`, VisibilityPublic},
+		{"public as a string", `{"to":"https://www.w3.org/ns/activitystreams#Public"}`, VisibilityPublic},
+		{"unlisted", `{"to":["https://remote.example/users/bob/followers"],"cc":["https://www.w3.org/ns/activitystreams#Public"]}`, VisibilityUnlisted},
+		{"followers", `{"to":["https://remote.example/users/bob/followers"],"cc":["https://example.com/ap/acct/alice"]}`, VisibilityFollowers},
+		{"direct", `{"to":["https://example.com/ap/acct/alice"],"cc":[]}`, VisibilityDirect},
+		{"followers only in cc", `{"to":["https://example.com/ap/acct/alice"],"cc":["https://remote.example/users/bob/followers"]}`, VisibilityDirect},
+		{"no addressing", `{}`, VisibilityDirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var object types.ApObject
+			err := json.Unmarshal([]byte(tt.object), &object)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Visibility(object); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	tests := []struct {
+		name  string
+		field any
+		want  []string
+	}{
+		{"string", "a", []string{"a"}},
+		{"strings", []string{"a", "b"}, []string{"a", "b"}},
+		{"decoded", []any{"a", map[string]any{"id": "b"}, "c"}, []string{"a", "c"}},
+		{"nil", nil, nil},
+		{"object", map[string]any{"id": "a"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Addresses(tt.field); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetchable(t *testing.T) {
+	tests := []struct {
+		visibility string
+		want       bool
+	}{
+		{VisibilityPublic, true},
+		{VisibilityUnlisted, true},
+		{VisibilityFollowers, false},
+		{VisibilityDirect, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.visibility, func(t *testing.T) {
+			to, cc := audience(tt.visibility, testActor, []string{"https://example.com/ap/acct/bob"})
+			if got := Fetchable(types.ApObject{To: to, CC: cc}); got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
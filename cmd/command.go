@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/concrnt/ccworld-ap-bridge/api"
+	"github.com/concrnt/ccworld-ap-bridge/store"
+)
+
+// runCommand runs a maintenance subcommand instead of the server.
+func runCommand(args []string, storeService *store.Store, apiService *api.Service) error {
+	ctx := context.Background()
+
+	switch args[0] {
+	case "rotate-key":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: rotate-key <entity id>")
+		}
+
+		entity, err := apiService.RotateKey(ctx, args[1])
+		if err != nil {
+			return err
+		}
+
+		log.Printf("rotated key of %s (version %d)", entity.ID, entity.KeyVersion)
+		return nil
+	case "encrypt-keys", "rotate-master-key":
+		// both seal plain keys and move keys sealed with a previous master key to the current one
+		updated, err := storeService.EncryptKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Printf("encrypted keys of %d entities", updated)
+		return nil
+	default:
+		return fmt.Errorf("unknown command")
+	}
+}
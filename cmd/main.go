@@ -138,16 +138,22 @@ func main() {
 		panic("failed to setup tracing plugin")
 	}
 
-	mc := memcache.New(config.Server.MemcachedAddr)
-	defer mc.Close()
+	// memcache is an optional cache in front of the database
+	var mc *memcache.Client
+	if config.Server.MemcachedAddr != "" {
+		mc = memcache.New(config.Server.MemcachedAddr)
+		defer mc.Close()
+	}
 
 	// Migrate the schema
 	log.Println("start migrate")
 	db.AutoMigrate(
 		&types.ApEntity{},
+		&types.RemoteActor{},
 		&types.ApFollow{},
 		&types.ApFollower{},
 		&types.ApObjectReference{},
+		&types.ApSentNote{},
 		&types.ApUserSettings{},
 	)
 
@@ -169,25 +175,42 @@ func main() {
 		panic("failed to setup tracing plugin")
 	}
 
-	storeService := store.NewStore(db)
+	keyring, err := store.NewKeyring(config.ApConfig.KeyEncryption)
+	if err != nil {
+		panic("failed to load master key: " + err.Error())
+	}
+
+	storeService := store.NewStore(db, keyring)
 	client := client.NewClient(config.Server.GatewayAddr)
 	client.SetUserAgent("CCWorld-AP-Bridge", version)
 	apclient := apclient.NewApClient(mc, storeService, config.ApConfig)
 
 	bridge := bridge.NewService(storeService, client, apclient, config.ApConfig)
 
+	rateLimiter := apmiddleware.NewRateLimiter(rdb, config.ApConfig.RateLimit)
+
 	apService := ap.NewService(
+		rdb,
 		storeService,
 		client,
 		apclient,
 		bridge,
+		rateLimiter,
 		config.NodeInfo,
 		config.ApConfig,
 	)
 
-	apiService := api.NewService(storeService, client, apclient, bridge, config.ApConfig)
+	apiService := api.NewService(rdb, storeService, client, apclient, bridge, config.ApConfig)
 	apiHandler := api.NewHandler(apiService)
 
+	if len(os.Args) > 1 {
+		err := runCommand(os.Args[1:], storeService, apiService)
+		if err != nil {
+			log.Fatalf("%s: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	apHandler := ap.NewHandler(apService)
 
 	worker := worker.NewWorker(rdb, storeService, client, apclient, bridge, config.ApConfig)
@@ -207,23 +230,32 @@ func main() {
 	ap := e.Group("/ap")
 	ap.GET("/nodeinfo/2.0", apHandler.NodeInfo)
 	ap.GET("/acct/:id", apHandler.User)
-	ap.POST("/acct/:id/inbox", apHandler.Inbox)
+	ap.POST("/acct/:id/inbox", apHandler.Inbox, rateLimiter.Middleware)
 	ap.GET("/acct/:id/outbox", apHandler.Outbox)
+	ap.GET("/acct/:id/followers", apHandler.Followers)
+	ap.GET("/acct/:id/following", apHandler.Following)
+	ap.GET("/acct/:id/collections/featured", apHandler.Featured)
 	ap.GET("/note/:id", apHandler.Note)
 
-	ap.POST("/inbox", apHandler.Inbox)
-
-	ap.GET("/api/entity", apiHandler.GetEntity, auth.Restrict(auth.ISREGISTERED))                      // ISLOCAL
-	ap.GET("/api/entity/:ccid", apiHandler.GetEntity, auth.Restrict(auth.ISREGISTERED))                // ISLOCAL
-	ap.POST("/api/entity", apiHandler.CreateEntity, auth.Restrict(auth.ISREGISTERED))                  // ISLOCAL
-	ap.POST("/api/follow/:id", apiHandler.Follow, auth.Restrict(auth.ISREGISTERED))                    // ISLOCAL
-	ap.DELETE("/api/follow/:id", apiHandler.UnFollow, auth.Restrict(auth.ISREGISTERED))                // ISLOCAL
-	ap.GET("/api/resolve/:id", apiHandler.ResolvePerson, auth.Restrict(auth.ISREGISTERED))             // ISLOCAL
-	ap.GET("/api/stats", apiHandler.GetStats, auth.Restrict(auth.ISREGISTERED))                        // ISLOCAL
-	ap.POST("/api/entities/aliases", apiHandler.UpdateEntityAliases, auth.Restrict(auth.ISREGISTERED)) // ISLOCAL
-	ap.GET("/api/import", apiHandler.ImportNote, auth.Restrict(auth.ISREGISTERED))                     // ISLOCAL
-	ap.GET("/api/settings", apiHandler.GetUserSettings, auth.Restrict(auth.ISREGISTERED))              // ISLOCAL
-	ap.POST("/api/settings", apiHandler.UpdateUserSettings, auth.Restrict(auth.ISREGISTERED))          // ISLOCAL
+	ap.POST("/inbox", apHandler.Inbox, rateLimiter.Middleware)
+
+	ap.GET("/api/entity", apiHandler.GetEntity, auth.Restrict(auth.ISREGISTERED))                                // ISLOCAL
+	ap.GET("/api/entity/:ccid", apiHandler.GetEntity, auth.Restrict(auth.ISREGISTERED))                          // ISLOCAL
+	ap.POST("/api/entity", apiHandler.CreateEntity, auth.Restrict(auth.ISREGISTERED))                            // ISLOCAL
+	ap.POST("/api/follow/:id", apiHandler.Follow, auth.Restrict(auth.ISREGISTERED))                              // ISLOCAL
+	ap.DELETE("/api/follow/:id", apiHandler.UnFollow, auth.Restrict(auth.ISREGISTERED))                          // ISLOCAL
+	ap.GET("/api/resolve/:id", apiHandler.ResolvePerson, auth.Restrict(auth.ISREGISTERED))                       // ISLOCAL
+	ap.GET("/api/stats", apiHandler.GetStats, auth.Restrict(auth.ISREGISTERED))                                  // ISLOCAL
+	ap.POST("/api/entities/aliases", apiHandler.UpdateEntityAliases, auth.Restrict(auth.ISREGISTERED))           // ISLOCAL
+	ap.GET("/api/import", apiHandler.ImportNote, auth.Restrict(auth.ISREGISTERED))                               // ISLOCAL
+	ap.GET("/api/settings", apiHandler.GetUserSettings, auth.Restrict(auth.ISREGISTERED))                        // ISLOCAL
+	ap.POST("/api/settings", apiHandler.UpdateUserSettings, auth.Restrict(auth.ISREGISTERED))                    // ISLOCAL
+	ap.POST("/api/report", apiHandler.Report, auth.Restrict(auth.ISREGISTERED))                                  // ISLOCAL
+	ap.POST("/api/entity/rotate-key", apiHandler.RotateKey, auth.Restrict(auth.ISREGISTERED))                    // ISLOCAL
+	ap.GET("/api/entity/subprofiles", apiHandler.GetSubprofileEntities, auth.Restrict(auth.ISREGISTERED))        // ISLOCAL
+	ap.POST("/api/entity/subprofile", apiHandler.CreateSubprofileEntity, auth.Restrict(auth.ISREGISTERED))       // ISLOCAL
+	ap.DELETE("/api/entity/subprofile/:id", apiHandler.DeleteSubprofileEntity, auth.Restrict(auth.ISREGISTERED)) // ISLOCAL
+	ap.POST("/api/entity/group", apiHandler.CreateGroupEntity, auth.Restrict(auth.ISREGISTERED))                 // ISLOCAL
 
 	e.GET("/health", func(c echo.Context) (err error) {
 		ctx := c.Request().Context()
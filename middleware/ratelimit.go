@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+var throttledRequests = promauto.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ccapi",
+		Subsystem: "inbox",
+		Name:      "throttled_total",
+		Help:      "Number of inbound deliveries rejected by the rate limiter.",
+	},
+	[]string{"scope"},
+)
+
+// tokenBuckets refills the buckets at KEYS and takes one token from each of them,
+// but only when every bucket has one left. ARGV[1] is the current time in milliseconds,
+// followed by the rate and burst of each bucket.
+// It returns {rejected, retryAfterMillis}, where rejected is the 1-based index of the
+// bucket that ran out, or 0 when the tokens were taken.
+var tokenBuckets = redis.NewScript(`
+local now = tonumber(ARGV[1])
+
+local tokens = {}
+local rejected = 0
+local retry = 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+
+	local state = redis.call("HMGET", key, "tokens", "ts")
+	local t = tonumber(state[1])
+	local ts = tonumber(state[2])
+	if t == nil or ts == nil then
+		t = burst
+		ts = now
+	end
+
+	t = math.min(burst, t + math.max(0, now - ts) / 1000 * rate)
+	if t < 1 then
+		local wait = math.ceil((1 - t) / rate * 1000)
+		if wait > retry then
+			rejected = i
+			retry = wait
+		end
+	end
+	tokens[i] = t
+end
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+
+	local t = tokens[i]
+	if rejected == 0 then
+		t = t - 1
+	end
+
+	redis.call("HSET", key, "tokens", tostring(t), "ts", tostring(now))
+	redis.call("PEXPIRE", key, math.ceil(burst / rate * 1000) + 1000)
+end
+return {rejected, retry}
+`)
+
+// ThrottledError is returned when a bucket of the rate limiter is empty.
+type ThrottledError struct {
+	Scope      string
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return "rate limited by " + e.Scope + " bucket"
+}
+
+type bucket struct {
+	scope string
+	key   string
+	rate  float64
+	burst int
+}
+
+// RateLimiter throttles inbound deliveries per client IP, and per signing actor and domain once the signature is verified.
+type RateLimiter struct {
+	rdb    *redis.Client
+	config types.RateLimitConfig
+}
+
+// NewRateLimiter returns a new RateLimiter.
+func NewRateLimiter(rdb *redis.Client, config types.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		rdb,
+		config,
+	}
+}
+
+// Middleware rejects requests with 429 once the bucket of the client IP is empty.
+// It runs before the signature is verified, so it must not trust anything the request claims.
+func (r *RateLimiter) Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if r == nil || !r.config.Enabled {
+			return next(c)
+		}
+
+		throttled := r.take(c.Request().Context(), []bucket{
+			{"ip", c.RealIP(), r.config.IPRate, r.config.IPBurst},
+		})
+		if throttled != nil {
+			return Throttle(c, throttled)
+		}
+
+		return next(c)
+	}
+}
+
+// TakeSigner takes a token from the buckets of a verified signing actor and its domain.
+// It returns a *ThrottledError when either of them is empty.
+func (r *RateLimiter) TakeSigner(ctx context.Context, actor string) error {
+	if r == nil || !r.config.Enabled {
+		return nil
+	}
+
+	domain := ""
+	if u, err := url.Parse(actor); err == nil {
+		domain = u.Hostname()
+	}
+
+	throttled := r.take(ctx, []bucket{
+		{"domain", domain, r.config.DomainRate, r.config.DomainBurst},
+		{"actor", actor, r.config.ActorRate, r.config.ActorBurst},
+	})
+	if throttled != nil {
+		return throttled
+	}
+	return nil
+}
+
+// Throttle responds with 429 and a Retry-After header for a *ThrottledError.
+func Throttle(c echo.Context, err *ThrottledError) error {
+	retryAfter := (err.RetryAfter + time.Second - 1) / time.Second
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(int64(retryAfter), 10))
+	return c.String(http.StatusTooManyRequests, "Too many requests")
+}
+
+// scriptArgs returns the keys, scopes and arguments of tokenBuckets for the buckets that are configured.
+func scriptArgs(buckets []bucket, now time.Time) ([]string, []string, []any) {
+	var keys []string
+	var scopes []string
+	args := []any{now.UnixMilli()}
+	for _, b := range buckets {
+		if b.key == "" || b.rate <= 0 || b.burst <= 0 {
+			continue
+		}
+		keys = append(keys, "ap:ratelimit:"+b.scope+":"+b.key)
+		scopes = append(scopes, b.scope)
+		args = append(args, b.rate, b.burst)
+	}
+	return keys, scopes, args
+}
+
+// take takes a token from every bucket at once, or from none of them.
+func (r *RateLimiter) take(ctx context.Context, buckets []bucket) *ThrottledError {
+	keys, scopes, args := scriptArgs(buckets, time.Now())
+	if len(keys) == 0 {
+		return nil
+	}
+
+	result, err := tokenBuckets.Run(ctx, r.rdb, keys, args...).Int64Slice()
+	if err != nil {
+		// fail open: redis trouble must not stop federation
+		log.Printf("middleware/ratelimit %v", err)
+		return nil
+	}
+
+	if result[0] == 0 {
+		return nil
+	}
+
+	scope := scopes[result[0]-1]
+	throttledRequests.WithLabelValues(scope).Inc()
+	return &ThrottledError{
+		Scope:      scope,
+		RetryAfter: time.Duration(result[1]) * time.Millisecond,
+	}
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+func TestScriptArgs(t *testing.T) {
+	now := time.UnixMilli(1718000000123)
+
+	tests := []struct {
+		name    string
+		buckets []bucket
+		keys    []string
+		scopes  []string
+		args    []any
+	}{
+		{
+			name: "signer",
+			buckets: []bucket{
+				{"domain", "remote.example", 10, 100},
+				{"actor", "https://remote.example/users/bob", 1, 20},
+			},
+			keys:   []string{"ap:ratelimit:domain:remote.example", "ap:ratelimit:actor:https://remote.example/users/bob"},
+			scopes: []string{"domain", "actor"},
+			args:   []any{int64(1718000000123), 10.0, 100, 1.0, 20},
+		},
+		{
+			name: "unconfigured buckets are skipped",
+			buckets: []bucket{
+				{"domain", "remote.example", 0, 100},
+				{"actor", "https://remote.example/users/bob", 1, 0},
+				{"ip", "192.0.2.1", 5, 50},
+			},
+			keys:   []string{"ap:ratelimit:ip:192.0.2.1"},
+			scopes: []string{"ip"},
+			args:   []any{int64(1718000000123), 5.0, 50},
+		},
+		{
+			name: "empty keys are skipped",
+			buckets: []bucket{
+				{"domain", "", 10, 100},
+				{"actor", "bob", 1, 20},
+			},
+			keys:   []string{"ap:ratelimit:actor:bob"},
+			scopes: []string{"actor"},
+			args:   []any{int64(1718000000123), 1.0, 20},
+		},
+		{
+			name:    "nothing configured",
+			buckets: []bucket{{"ip", "192.0.2.1", 0, 0}},
+			args:    []any{int64(1718000000123)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, scopes, args := scriptArgs(tt.buckets, now)
+			if !reflect.DeepEqual(keys, tt.keys) || !reflect.DeepEqual(scopes, tt.scopes) || !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("got %v %v %v, want %v %v %v", keys, scopes, args, tt.keys, tt.scopes, tt.args)
+			}
+			// the script reads the rate and burst of bucket i from ARGV[i*2] and ARGV[i*2+1]
+			if len(args) != 1+2*len(keys) {
+				t.Fatalf("%d args for %d keys", len(args), len(keys))
+			}
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	tests := []struct {
+		retryAfter time.Duration
+		want       string
+	}{
+		{0, "0"},
+		{time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+		{time.Minute, "60"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.retryAfter.String(), func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/ap/inbox", nil), rec)
+
+			err := Throttle(c, &ThrottledError{Scope: "ip", RetryAfter: tt.retryAfter})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != http.StatusTooManyRequests {
+				t.Fatalf("status %d", rec.Code)
+			}
+			if got := rec.Header().Get("Retry-After"); got != tt.want {
+				t.Fatalf("Retry-After %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	// a nil redis client would panic if the limiter touched it
+	limiters := map[string]*RateLimiter{
+		"nil":      nil,
+		"disabled": NewRateLimiter(nil, types.RateLimitConfig{IPRate: 1, IPBurst: 1, ActorRate: 1, ActorBurst: 1}),
+	}
+
+	for name, limiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			err := limiter.TakeSigner(context.Background(), "https://remote.example/users/bob")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			called := false
+			handler := limiter.Middleware(func(c echo.Context) error {
+				called = true
+				return nil
+			})
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/ap/inbox", nil), httptest.NewRecorder())
+			err = handler(c)
+			if err != nil || !called {
+				t.Fatalf("err = %v, called = %v", err, called)
+			}
+		})
+	}
+}
+
+func TestRateLimiterFailsOpen(t *testing.T) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:        "127.0.0.1:1",
+		DialTimeout: 100 * time.Millisecond,
+		MaxRetries:  -1,
+	})
+	defer rdb.Close()
+
+	limiter := NewRateLimiter(rdb, types.RateLimitConfig{
+		Enabled:     true,
+		IPRate:      1,
+		IPBurst:     1,
+		ActorRate:   1,
+		ActorBurst:  1,
+		DomainRate:  1,
+		DomainBurst: 1,
+	})
+
+	err := limiter.TakeSigner(context.Background(), "https://remote.example/users/bob")
+	if err != nil {
+		t.Fatalf("TakeSigner = %v while redis is down", err)
+	}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/ap/inbox", nil), rec)
+	err = limiter.Middleware(func(c echo.Context) error {
+		return c.NoContent(http.StatusAccepted)
+	})(c)
+	if err != nil || rec.Code != http.StatusAccepted {
+		t.Fatalf("err = %v, status %d while redis is down", err, rec.Code)
+	}
+}
@@ -0,0 +1,18 @@
+package signature
+
+import (
+	"strings"
+)
+
+// CavageParams parses the parameters of a draft-cavage Signature header.
+func CavageParams(header string) map[string]string {
+	params := make(map[string]string)
+	for _, param := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if !ok {
+			continue
+		}
+		params[key] = strings.Trim(value, `"`)
+	}
+	return params
+}
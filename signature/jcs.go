@@ -0,0 +1,150 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Canonicalize serializes a decoded JSON value following RFC 8785 (JCS).
+func Canonicalize(v any) ([]byte, error) {
+	var b bytes.Buffer
+	err := canonicalize(&b, v)
+	return b.Bytes(), err
+}
+
+// CanonicalizeJSON decodes raw JSON and serializes it following RFC 8785 (JCS).
+func CanonicalizeJSON(raw []byte) ([]byte, error) {
+	var v any
+	err := json.Unmarshal(raw, &v)
+	if err != nil {
+		return nil, err
+	}
+	return Canonicalize(v)
+}
+
+func canonicalize(b *bytes.Buffer, v any) error {
+	switch value := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		if value {
+			b.WriteString("true")
+		} else {
+			b.WriteString("false")
+		}
+	case float64:
+		s, err := formatNumber(value)
+		if err != nil {
+			return err
+		}
+		b.WriteString(s)
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		return canonicalize(b, f)
+	case string:
+		writeString(b, value)
+	case []any:
+		b.WriteByte('[')
+		for i, item := range value {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			err := canonicalize(b, item)
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		// members are sorted by their UTF-16 code units
+		sort.Slice(keys, func(i, j int) bool {
+			a, b := utf16.Encode([]rune(keys[i])), utf16.Encode([]rune(keys[j]))
+			for k := 0; k < len(a) && k < len(b); k++ {
+				if a[k] != b[k] {
+					return a[k] < b[k]
+				}
+			}
+			return len(a) < len(b)
+		})
+
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeString(b, k)
+			b.WriteByte(':')
+			err := canonicalize(b, value[k])
+			if err != nil {
+				return err
+			}
+		}
+		b.WriteByte('}')
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+	return nil
+}
+
+// formatNumber formats f like ECMAScript Number.prototype.toString.
+func formatNumber(f float64) (string, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return "", fmt.Errorf("invalid number")
+	}
+	if f == 0 {
+		return "0", nil
+	}
+
+	abs := math.Abs(f)
+	if abs >= 1e-6 && abs < 1e21 {
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exponent, _ := strings.Cut(s, "e")
+	sign := exponent[0]
+	exponent = strings.TrimLeft(exponent[1:], "0")
+	return mantissa + "e" + string(sign) + exponent, nil
+}
+
+func writeString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				fmt.Fprintf(b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+}
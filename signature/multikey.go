@@ -0,0 +1,80 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// multicodec prefix of an ed25519-pub key
+var ed25519MulticodecPrefix = []byte{0xed, 0x01}
+
+// EncodeMultikey encodes an Ed25519 public key as a FEP-521a publicKeyMultibase value.
+func EncodeMultikey(pub ed25519.PublicKey) string {
+	return "z" + base58Encode(append(append([]byte{}, ed25519MulticodecPrefix...), pub...))
+}
+
+// DecodeMultikey decodes a publicKeyMultibase value into a public key.
+func DecodeMultikey(multibase string) (crypto.PublicKey, error) {
+	if !strings.HasPrefix(multibase, "z") {
+		return nil, fmt.Errorf("unsupported multibase encoding")
+	}
+
+	decoded, err := base58Decode(multibase[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	if len(decoded) != 2+ed25519.PublicKeySize || decoded[0] != ed25519MulticodecPrefix[0] || decoded[1] != ed25519MulticodecPrefix[1] {
+		return nil, fmt.Errorf("unsupported multikey")
+	}
+
+	return ed25519.PublicKey(decoded[2:]), nil
+}
+
+func base58Encode(data []byte) string {
+	n := new(big.Int).SetBytes(data)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+	for _, b := range data {
+		if b != 0 {
+			break
+		}
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	n := new(big.Int)
+	radix := big.NewInt(58)
+	for _, c := range s {
+		idx := strings.IndexRune(base58Alphabet, c)
+		if idx < 0 {
+			return nil, fmt.Errorf("invalid base58 character %q", c)
+		}
+		n.Mul(n, radix)
+		n.Add(n, big.NewInt(int64(idx)))
+	}
+
+	decoded := n.Bytes()
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	return append(make([]byte, zeros), decoded...), nil
+}
@@ -0,0 +1,108 @@
+package signature
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+)
+
+// key pair of the W3C Data Integrity EdDSA cryptosuites test vectors
+const (
+	testPublicKeyMultibase = "z6MkrJVnaZkeFzdQyMZu1cgjg7k1pZZ6pvBQ7XJPt4swbTQ2"
+	testSecretKeyMultibase = "z3u2en7t5LR2WtQH5PfFqMqwVHBeXouLzo6haApm8XHqvjxq"
+)
+
+// testPrivateKey decodes the ed25519-priv multikey of the test vectors.
+func testPrivateKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	decoded, err := base58Decode(testSecretKeyMultibase[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// multicodec prefix of an ed25519-priv key
+	if len(decoded) != 2+ed25519.SeedSize || decoded[0] != 0x80 || decoded[1] != 0x26 {
+		t.Fatalf("unexpected secret key multikey %x", decoded)
+	}
+	return ed25519.NewKeyFromSeed(decoded[2:])
+}
+
+// vectors from draft-msporny-base58
+func TestBase58(t *testing.T) {
+	tests := []struct {
+		data    []byte
+		encoded string
+	}{
+		{[]byte("Hello World!"), "2NEpo7TZRRrLZSi2U"},
+		{[]byte("The quick brown fox jumps over the lazy dog."), "USm3fpXnKG5EUBx2ndxBDMPVciP5hGey2Jh4NDv6gmeo1LkMeiKrLJUUBk6Z"},
+		{[]byte{0x00, 0x00, 0x00, 0x28, 0x7f, 0xb4, 0xcd}, "111233QC4"},
+		{[]byte{0x00}, "1"},
+		{[]byte{}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := base58Encode(tt.data); got != tt.encoded {
+			t.Errorf("base58Encode(%x) = %s, want %s", tt.data, got, tt.encoded)
+		}
+		got, err := base58Decode(tt.encoded)
+		if err != nil {
+			t.Errorf("base58Decode(%s): %v", tt.encoded, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.data) {
+			t.Errorf("base58Decode(%s) = %x, want %x", tt.encoded, got, tt.data)
+		}
+	}
+
+	_, err := base58Decode("0OIl")
+	if err == nil {
+		t.Error("base58Decode accepted characters outside the alphabet")
+	}
+}
+
+func TestMultikey(t *testing.T) {
+	pub := testPrivateKey(t).Public().(ed25519.PublicKey)
+	if got := EncodeMultikey(pub); got != testPublicKeyMultibase {
+		t.Fatalf("EncodeMultikey = %s, want %s", got, testPublicKeyMultibase)
+	}
+
+	for i := 0; i < 16; i++ {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// force leading zero bytes now and then
+		if i%4 == 0 {
+			pub[0] = 0
+		}
+
+		decoded, err := DecodeMultikey(EncodeMultikey(pub))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pub.Equal(decoded) {
+			t.Fatalf("round trip of %x gave %x", pub, decoded)
+		}
+	}
+}
+
+func TestDecodeMultikeyErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		multibase string
+	}{
+		{"base64 multibase", "m7QE"},
+		{"invalid base58", "z0OIl"},
+		{"secret key", testSecretKeyMultibase},
+		{"truncated", testPublicKeyMultibase[:len(testPublicKeyMultibase)-4]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeMultikey(tt.multibase)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
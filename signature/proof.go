@@ -0,0 +1,169 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	ProofType        = "DataIntegrityProof"
+	Cryptosuite      = "eddsa-jcs-2022"
+	ProofPurpose     = "assertionMethod"
+	DataIntegrityCtx = "https://w3id.org/security/data-integrity/v2"
+)
+
+// ToMap converts an object into its decoded JSON form.
+func ToMap(object any) (map[string]any, error) {
+	if m, ok := object.(map[string]any); ok {
+		return m, nil
+	}
+
+	b, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]any
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// AddProof attaches a FEP-8b32 eddsa-jcs-2022 DataIntegrityProof to document.
+// The data integrity context is added to @context when missing.
+func AddProof(document map[string]any, priv ed25519.PrivateKey, verificationMethod string) (map[string]any, error) {
+	unsecured := make(map[string]any, len(document))
+	for k, v := range document {
+		if k != "proof" {
+			unsecured[k] = v
+		}
+	}
+	unsecured["@context"] = withDataIntegrityContext(unsecured["@context"])
+
+	proof := map[string]any{
+		"@context":           unsecured["@context"],
+		"type":               ProofType,
+		"cryptosuite":        Cryptosuite,
+		"verificationMethod": verificationMethod,
+		"proofPurpose":       ProofPurpose,
+		"created":            time.Now().UTC().Format(time.RFC3339),
+	}
+
+	hashData, err := proofHashData(unsecured, proof)
+	if err != nil {
+		return nil, err
+	}
+
+	proof["proofValue"] = "z" + base58Encode(ed25519.Sign(priv, hashData))
+
+	secured := unsecured
+	secured["proof"] = proof
+	return secured, nil
+}
+
+// ProofVerificationMethod returns the verification method of the document proof, if any.
+func ProofVerificationMethod(document map[string]any) (string, bool) {
+	proof, ok := document["proof"].(map[string]any)
+	if !ok {
+		return "", false
+	}
+	vm, ok := proof["verificationMethod"].(string)
+	return vm, ok && vm != ""
+}
+
+// VerifyProof verifies the eddsa-jcs-2022 proof of document against pub.
+func VerifyProof(document map[string]any, pub crypto.PublicKey) error {
+	proof, ok := document["proof"].(map[string]any)
+	if !ok {
+		return fmt.Errorf("no proof")
+	}
+
+	if proof["type"] != ProofType || proof["cryptosuite"] != Cryptosuite {
+		return fmt.Errorf("unsupported proof %v/%v", proof["type"], proof["cryptosuite"])
+	}
+	if proof["proofPurpose"] != ProofPurpose {
+		return fmt.Errorf("unexpected proof purpose %v", proof["proofPurpose"])
+	}
+
+	proofValue, ok := proof["proofValue"].(string)
+	if !ok || len(proofValue) < 2 || proofValue[0] != 'z' {
+		return fmt.Errorf("invalid proofValue")
+	}
+	sig, err := base58Decode(proofValue[1:])
+	if err != nil {
+		return err
+	}
+
+	edPub, ok := pub.(ed25519.PublicKey)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+
+	unsecured := make(map[string]any, len(document))
+	for k, v := range document {
+		if k != "proof" {
+			unsecured[k] = v
+		}
+	}
+
+	options := make(map[string]any, len(proof))
+	for k, v := range proof {
+		if k != "proofValue" {
+			options[k] = v
+		}
+	}
+	if _, ok := options["@context"]; !ok {
+		if ctx, ok := unsecured["@context"]; ok {
+			options["@context"] = ctx
+		}
+	}
+
+	hashData, err := proofHashData(unsecured, options)
+	if err != nil {
+		return err
+	}
+
+	if !ed25519.Verify(edPub, hashData, sig) {
+		return fmt.Errorf("invalid proof signature")
+	}
+	return nil
+}
+
+func proofHashData(unsecured, proofConfig map[string]any) ([]byte, error) {
+	canonicalConfig, err := Canonicalize(proofConfig)
+	if err != nil {
+		return nil, err
+	}
+	canonicalDocument, err := Canonicalize(unsecured)
+	if err != nil {
+		return nil, err
+	}
+
+	configHash := sha256.Sum256(canonicalConfig)
+	documentHash := sha256.Sum256(canonicalDocument)
+	return append(configHash[:], documentHash[:]...), nil
+}
+
+func withDataIntegrityContext(context any) any {
+	switch ctx := context.(type) {
+	case nil:
+		return []any{"https://www.w3.org/ns/activitystreams", DataIntegrityCtx}
+	case string:
+		if ctx == DataIntegrityCtx {
+			return ctx
+		}
+		return []any{ctx, DataIntegrityCtx}
+	case []any:
+		for _, c := range ctx {
+			if c == DataIntegrityCtx {
+				return ctx
+			}
+		}
+		return append(append([]any{}, ctx...), DataIntegrityCtx)
+	default:
+		return []any{ctx, DataIntegrityCtx}
+	}
+}
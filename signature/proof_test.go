@@ -0,0 +1,150 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+)
+
+const testVerificationMethod = "https://example.com/ap/acct/alice#ed25519-key"
+
+func testNote() map[string]any {
+	return map[string]any{
+		"@context":     "https://www.w3.org/ns/activitystreams",
+		"id":           "https://example.com/ap/note/1",
+		"type":         "Note",
+		"attributedTo": "https://example.com/ap/acct/alice",
+		"content":      "héllo 😀",
+		"to":           []any{"https://www.w3.org/ns/activitystreams#Public"},
+	}
+}
+
+// decode round-trips document through JSON like a received activity.
+func decode(t *testing.T, document map[string]any) map[string]any {
+	t.Helper()
+	b, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]any
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// TestVerifyProofVector checks the FEP-8b32 hashing against canonical forms written out by hand:
+// the signed data is SHA-256 of the JCS proof options followed by SHA-256 of the JCS document.
+func TestVerifyProofVector(t *testing.T) {
+	priv := testPrivateKey(t)
+
+	canonicalConfig := `{"@context":["https://www.w3.org/ns/activitystreams","https://w3id.org/security/data-integrity/v2"],` +
+		`"created":"2024-01-01T00:00:00Z","cryptosuite":"eddsa-jcs-2022","proofPurpose":"assertionMethod",` +
+		`"type":"DataIntegrityProof","verificationMethod":"` + testVerificationMethod + `"}`
+	canonicalDocument := `{"@context":["https://www.w3.org/ns/activitystreams","https://w3id.org/security/data-integrity/v2"],` +
+		`"attributedTo":"https://example.com/ap/acct/alice","content":"héllo 😀","id":"https://example.com/ap/note/1",` +
+		`"to":["https://www.w3.org/ns/activitystreams#Public"],"type":"Note"}`
+
+	configHash := sha256.Sum256([]byte(canonicalConfig))
+	documentHash := sha256.Sum256([]byte(canonicalDocument))
+	sig := ed25519.Sign(priv, append(configHash[:], documentHash[:]...))
+
+	var proof map[string]any
+	err := json.Unmarshal([]byte(canonicalConfig), &proof)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proof["proofValue"] = "z" + base58Encode(sig)
+
+	var document map[string]any
+	err = json.Unmarshal([]byte(canonicalDocument), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document["proof"] = proof
+
+	err = VerifyProof(document, priv.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyProof(t *testing.T) {
+	priv := testPrivateKey(t)
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tamper  func(document map[string]any)
+		pub     any
+		wantErr bool
+	}{
+		{"valid", func(map[string]any) {}, priv.Public(), false},
+		{"other key", func(map[string]any) {}, otherPriv.Public(), true},
+		{"changed content", func(d map[string]any) { d["content"] = "bye" }, priv.Public(), true},
+		{"added member", func(d map[string]any) { d["cc"] = []any{} }, priv.Public(), true},
+		{"changed verification method", func(d map[string]any) {
+			d["proof"].(map[string]any)["verificationMethod"] = "https://example.com/ap/acct/bob#ed25519-key"
+		}, priv.Public(), true},
+		{"changed created", func(d map[string]any) {
+			d["proof"].(map[string]any)["created"] = "2000-01-01T00:00:00Z"
+		}, priv.Public(), true},
+		{"other cryptosuite", func(d map[string]any) {
+			d["proof"].(map[string]any)["cryptosuite"] = "eddsa-rdfc-2022"
+		}, priv.Public(), true},
+		{"other purpose", func(d map[string]any) {
+			d["proof"].(map[string]any)["proofPurpose"] = "authentication"
+		}, priv.Public(), true},
+		{"proofValue not multibase", func(d map[string]any) {
+			d["proof"].(map[string]any)["proofValue"] = "abc"
+		}, priv.Public(), true},
+		{"no proof", func(d map[string]any) { delete(d, "proof") }, priv.Public(), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			secured, err := AddProof(testNote(), priv, testVerificationMethod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			document := decode(t, secured)
+			tt.tamper(document)
+
+			err = VerifyProof(document, tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAddProof(t *testing.T) {
+	secured, err := AddProof(testNote(), testPrivateKey(t), testVerificationMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := ProofVerificationMethod(secured)
+	if !ok || vm != testVerificationMethod {
+		t.Fatalf("verification method = %q, %v", vm, ok)
+	}
+
+	context, ok := secured["@context"].([]any)
+	if !ok || len(context) != 2 || context[1] != DataIntegrityCtx {
+		t.Fatalf("@context = %v", secured["@context"])
+	}
+
+	// signing twice must not add the context again
+	again, err := AddProof(decode(t, secured), testPrivateKey(t), testVerificationMethod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again["@context"].([]any)) != 2 {
+		t.Fatalf("@context = %v", again["@context"])
+	}
+}
@@ -0,0 +1,391 @@
+package signature
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AlgRsaV15Sha256    = "rsa-v1_5-sha256"
+	AlgRsaPssSha512    = "rsa-pss-sha512"
+	AlgEcdsaP256Sha256 = "ecdsa-p256-sha256"
+	AlgEd25519         = "ed25519"
+
+	label = "sig1"
+)
+
+// Input is a parsed member of a Signature-Input header.
+type Input struct {
+	Label      string
+	Components []string
+	KeyID      string
+	Alg        string
+	Created    int64
+	Expires    int64
+
+	// raw serialization, used verbatim as @signature-params
+	raw string
+}
+
+// HasComponent reports whether name is covered by the signature.
+func (i Input) HasComponent(name string) bool {
+	for _, c := range i.Components {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsRFC9421 reports whether the request carries an RFC 9421 signature.
+func IsRFC9421(r *http.Request) bool {
+	return r.Header.Get("Signature-Input") != ""
+}
+
+// ParseRequest returns the first signature of an RFC 9421 signed request.
+func ParseRequest(r *http.Request) (Input, []byte, error) {
+	inputs, err := parseDictionary(r.Header.Values("Signature-Input"))
+	if err != nil {
+		return Input{}, nil, err
+	}
+	if len(inputs) == 0 {
+		return Input{}, nil, fmt.Errorf("no signature input")
+	}
+
+	signatures, err := parseDictionary(r.Header.Values("Signature"))
+	if err != nil {
+		return Input{}, nil, err
+	}
+
+	member := inputs[0]
+	input, err := parseInput(member.key, member.value)
+	if err != nil {
+		return Input{}, nil, err
+	}
+
+	for _, sig := range signatures {
+		if sig.key != member.key {
+			continue
+		}
+		value := strings.TrimSpace(sig.value)
+		if !strings.HasPrefix(value, ":") || !strings.HasSuffix(value, ":") || len(value) < 2 {
+			return Input{}, nil, fmt.Errorf("malformed signature")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return Input{}, nil, err
+		}
+		return input, decoded, nil
+	}
+
+	return Input{}, nil, fmt.Errorf("signature %s not found", member.key)
+}
+
+// Sign adds RFC 9421 Signature-Input and Signature headers to the request.
+// POST bodies are covered through Content-Digest.
+func Sign(r *http.Request, body []byte, keyID string, key crypto.Signer) error {
+	components := []string{"@method", "@target-uri"}
+	if body != nil {
+		r.Header.Set("Content-Digest", ContentDigest(body))
+		components = append(components, "content-digest")
+	}
+
+	var alg string
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		alg = AlgRsaV15Sha256
+	case ed25519.PublicKey:
+		alg = AlgEd25519
+	default:
+		return fmt.Errorf("unsupported key type %T", key.Public())
+	}
+
+	quoted := make([]string, len(components))
+	for i, c := range components {
+		quoted[i] = strconv.Quote(c)
+	}
+	params := fmt.Sprintf("(%s);created=%d;keyid=%s;alg=%s",
+		strings.Join(quoted, " "),
+		time.Now().Unix(),
+		strconv.Quote(keyID),
+		strconv.Quote(alg),
+	)
+
+	base, err := signatureBase(r, components, params)
+	if err != nil {
+		return err
+	}
+
+	var sig []byte
+	switch alg {
+	case AlgRsaV15Sha256:
+		digest := sha256.Sum256([]byte(base))
+		sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	case AlgEd25519:
+		sig, err = key.Sign(rand.Reader, []byte(base), crypto.Hash(0))
+	}
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set("Signature-Input", label+"="+params)
+	r.Header.Set("Signature", label+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// Verify checks sig over the request against pub.
+// When the input has no alg parameter, the algorithm is derived from the key type.
+func Verify(r *http.Request, input Input, sig []byte, pub crypto.PublicKey) error {
+	base, err := signatureBase(r, input.Components, input.raw)
+	if err != nil {
+		return err
+	}
+
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		switch input.Alg {
+		case AlgRsaPssSha512:
+			digest := sha512.Sum512([]byte(base))
+			return rsa.VerifyPSS(key, crypto.SHA512, digest[:], sig, nil)
+		case AlgRsaV15Sha256, "":
+			digest := sha256.Sum256([]byte(base))
+			return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig)
+		}
+	case ed25519.PublicKey:
+		if input.Alg == AlgEd25519 || input.Alg == "" {
+			if !ed25519.Verify(key, []byte(base), sig) {
+				return fmt.Errorf("invalid signature")
+			}
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if (input.Alg == AlgEcdsaP256Sha256 || input.Alg == "") && len(sig) == 64 {
+			digest := sha256.Sum256([]byte(base))
+			r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+			if !ecdsa.Verify(key, digest[:], r, s) {
+				return fmt.Errorf("invalid signature")
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported algorithm %q for key type %T", input.Alg, pub)
+}
+
+// ContentDigest returns an RFC 9530 Content-Digest value for body.
+func ContentDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+// VerifyContentDigest checks an RFC 9530 Content-Digest header against body.
+func VerifyContentDigest(header string, body []byte) error {
+	members, err := parseDictionary([]string{header})
+	if err != nil {
+		return err
+	}
+
+	for _, member := range members {
+		var h hash.Hash
+		switch member.key {
+		case "sha-256":
+			h = sha256.New()
+		case "sha-512":
+			h = sha512.New()
+		default:
+			continue
+		}
+
+		value := strings.TrimSpace(member.value)
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return fmt.Errorf("malformed digest")
+		}
+		expected, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return err
+		}
+
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), expected) != 1 {
+			return ErrDigestMismatch
+		}
+		return nil
+	}
+
+	return ErrDigestUnsupported
+}
+
+var (
+	ErrDigestMismatch    = fmt.Errorf("digest mismatch")
+	ErrDigestUnsupported = fmt.Errorf("unsupported digest algorithm")
+)
+
+func signatureBase(r *http.Request, components []string, params string) (string, error) {
+	var b strings.Builder
+	for _, c := range components {
+		value, err := componentValue(r, c)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(strconv.Quote(c))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteString("\n")
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params)
+	return b.String(), nil
+}
+
+func authority(r *http.Request) string {
+	if r.Host != "" {
+		return strings.ToLower(r.Host)
+	}
+	return strings.ToLower(r.URL.Host)
+}
+
+func componentValue(r *http.Request, name string) (string, error) {
+	switch name {
+	case "@method":
+		return strings.ToUpper(r.Method), nil
+	case "@target-uri":
+		return "https://" + authority(r) + r.URL.RequestURI(), nil
+	case "@authority":
+		return authority(r), nil
+	case "@scheme":
+		return "https", nil
+	case "@request-target":
+		return r.URL.RequestURI(), nil
+	case "@path":
+		if r.URL.EscapedPath() == "" {
+			return "/", nil
+		}
+		return r.URL.EscapedPath(), nil
+	case "@query":
+		return "?" + r.URL.RawQuery, nil
+	}
+
+	if strings.HasPrefix(name, "@") {
+		return "", fmt.Errorf("unsupported component %s", name)
+	}
+
+	var raw []string
+	if name == "host" {
+		raw = []string{authority(r)}
+	} else {
+		raw = r.Header.Values(name)
+	}
+	if len(raw) == 0 {
+		return "", fmt.Errorf("missing header %s", name)
+	}
+
+	// Header.Values shares its slice with the request, which must stay untouched
+	values := make([]string, len(raw))
+	for i, v := range raw {
+		values[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+type member struct {
+	key   string
+	value string
+}
+
+// parseDictionary splits a structured field dictionary into its members
+// without interpreting the values.
+func parseDictionary(headers []string) ([]member, error) {
+	var members []member
+	for _, header := range headers {
+		for _, item := range splitOutside(header, ',') {
+			item = strings.TrimSpace(item)
+			if item == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(item, "=")
+			if !ok {
+				return nil, fmt.Errorf("malformed dictionary member %q", item)
+			}
+			members = append(members, member{strings.TrimSpace(key), value})
+		}
+	}
+	return members, nil
+}
+
+func parseInput(key, value string) (Input, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "(") {
+		return Input{}, fmt.Errorf("malformed signature input")
+	}
+	end := strings.Index(value, ")")
+	if end < 0 {
+		return Input{}, fmt.Errorf("malformed signature input")
+	}
+
+	input := Input{Label: key, raw: value}
+
+	for _, item := range strings.Fields(value[1:end]) {
+		if !strings.HasPrefix(item, `"`) || !strings.HasSuffix(item, `"`) {
+			return Input{}, fmt.Errorf("unsupported component %s", item)
+		}
+		input.Components = append(input.Components, strings.ToLower(strings.Trim(item, `"`)))
+	}
+
+	for _, param := range splitOutside(value[end+1:], ';') {
+		k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+		v = strings.Trim(v, `"`)
+		switch k {
+		case "keyid":
+			input.KeyID = v
+		case "alg":
+			input.Alg = v
+		case "created":
+			input.Created, _ = strconv.ParseInt(v, 10, 64)
+		case "expires":
+			input.Expires, _ = strconv.ParseInt(v, 10, 64)
+		}
+	}
+
+	if input.KeyID == "" {
+		return Input{}, fmt.Errorf("missing keyid")
+	}
+
+	return input, nil
+}
+
+// splitOutside splits s on sep, ignoring separators inside quotes or parentheses.
+func splitOutside(s string, sep rune) []string {
+	var parts []string
+	depth := 0
+	quoted := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case c == '"' && (i == 0 || s[i-1] != '\\'):
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
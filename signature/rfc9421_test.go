@@ -0,0 +1,284 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []string
+		signature []string
+		want      Input
+		wantSig   string
+		wantErr   bool
+	}{
+		{
+			name:      "single",
+			input:     []string{`sig1=("@method" "@target-uri" "content-digest");created=1618884473;keyid="https://example.com/actor#main-key";alg="rsa-v1_5-sha256"`},
+			signature: []string{`sig1=:AQID:`},
+			want: Input{
+				Label:      "sig1",
+				Components: []string{"@method", "@target-uri", "content-digest"},
+				KeyID:      "https://example.com/actor#main-key",
+				Alg:        AlgRsaV15Sha256,
+				Created:    1618884473,
+			},
+			wantSig: "\x01\x02\x03",
+		},
+		{
+			name:      "first of several labels across headers",
+			input:     []string{`a=("@method");keyid="k1";expires=1618884500`, `b=("@path");keyid="k2"`},
+			signature: []string{`b=:BAU=:`, `a=:AQ==:`},
+			want: Input{
+				Label:      "a",
+				Components: []string{"@method"},
+				KeyID:      "k1",
+				Expires:    1618884500,
+			},
+			wantSig: "\x01",
+		},
+		{
+			name:      "separators inside quotes",
+			input:     []string{`sig1=("@method" "date");keyid="https://example.com/a,b;c"`},
+			signature: []string{`sig1=:AQ==:`},
+			want: Input{
+				Label:      "sig1",
+				Components: []string{"@method", "date"},
+				KeyID:      "https://example.com/a,b;c",
+			},
+			wantSig: "\x01",
+		},
+		{
+			name:      "component names are case insensitive",
+			input:     []string{`sig1=("@Method" "Content-Digest");keyid="k"`},
+			signature: []string{`sig1=:AQ==:`},
+			want: Input{
+				Label:      "sig1",
+				Components: []string{"@method", "content-digest"},
+				KeyID:      "k",
+			},
+			wantSig: "\x01",
+		},
+		{
+			name:      "missing keyid",
+			input:     []string{`sig1=("@method");created=1`},
+			signature: []string{`sig1=:AQ==:`},
+			wantErr:   true,
+		},
+		{
+			name:      "missing signature",
+			input:     []string{`sig1=("@method");keyid="k"`},
+			signature: []string{`sig2=:AQ==:`},
+			wantErr:   true,
+		},
+		{
+			name:      "signature not a byte sequence",
+			input:     []string{`sig1=("@method");keyid="k"`},
+			signature: []string{`sig1="AQ=="`},
+			wantErr:   true,
+		},
+		{
+			name:      "signature not base64",
+			input:     []string{`sig1=("@method");keyid="k"`},
+			signature: []string{`sig1=:*:`},
+			wantErr:   true,
+		},
+		{
+			name:      "inner list not parenthesized",
+			input:     []string{`sig1="@method";keyid="k"`},
+			signature: []string{`sig1=:AQ==:`},
+			wantErr:   true,
+		},
+		{
+			name:      "unquoted component",
+			input:     []string{`sig1=(@method);keyid="k"`},
+			signature: []string{`sig1=:AQ==:`},
+			wantErr:   true,
+		},
+		{
+			name:      "member without value",
+			input:     []string{`sig1`},
+			signature: []string{`sig1=:AQ==:`},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "https://example.com/inbox", nil)
+			for _, v := range tt.input {
+				r.Header.Add("Signature-Input", v)
+			}
+			for _, v := range tt.signature {
+				r.Header.Add("Signature", v)
+			}
+
+			input, sig, err := ParseRequest(r)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			input.raw = ""
+			if !reflect.DeepEqual(input, tt.want) {
+				t.Fatalf("got  %+v\nwant %+v", input, tt.want)
+			}
+			if string(sig) != tt.wantSig {
+				t.Fatalf("signature %x, want %x", sig, tt.wantSig)
+			}
+		})
+	}
+}
+
+// TestVerifyRFCVector checks the Ed25519 example of RFC 9421 appendix B.2.6.
+func TestVerifyRFCVector(t *testing.T) {
+	block, _ := pem.Decode([]byte("-----BEGIN PUBLIC KEY-----\nMCowBQYDK2VwAyEAJrQLj5P/89iXES9+vFgrIy29clF9CC/oPPsw3c5D0bs=\n-----END PUBLIC KEY-----\n"))
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/foo?param=Value&Pet=dog", strings.NewReader(`{"hello": "world"}`))
+	r.Host = "example.com"
+	r.Header.Set("Date", "Tue, 20 Apr 2021 02:07:55 GMT")
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Content-Length", "18")
+	r.Header.Set("Signature-Input", `sig-b26=("date" "@method" "@path" "@authority" "content-type" "content-length");created=1618884473;keyid="test-key-ed25519"`)
+	r.Header.Set("Signature", `sig-b26=:wqcAqbmYJ2ji2glfAMaRy4gruYYnx2nEFN2HN6jrnDnQCK1u02Gb04v9EDgwUPiu4A0w6vuQv5lIp5WPpBKRCw==:`)
+
+	input, sig, err := ParseRequest(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Verify(r, input, sig, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.Header.Set("Content-Type", "text/plain")
+	if Verify(r, input, sig, pub) == nil {
+		t.Fatal("signature verified over a changed header")
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"type":"Follow"}`)
+
+	tests := []struct {
+		name    string
+		sign    func(r *http.Request) error
+		pub     any
+		tamper  func(r *http.Request)
+		wantErr bool
+	}{
+		{"rsa", func(r *http.Request) error { return Sign(r, body, "k", rsaKey) }, &rsaKey.PublicKey, func(*http.Request) {}, false},
+		{"ed25519", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, edPub, func(*http.Request) {}, false},
+		{"other method", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, edPub, func(r *http.Request) { r.Method = http.MethodPut }, true},
+		{"other path", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, edPub, func(r *http.Request) { r.URL.Path = "/ap/inbox" }, true},
+		{"other host", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, edPub, func(r *http.Request) { r.Host = "evil.example" }, true},
+		{"other digest", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, edPub, func(r *http.Request) { r.Header.Set("Content-Digest", ContentDigest([]byte("{}"))) }, true},
+		{"key mismatch", func(r *http.Request) error { return Sign(r, body, "k", edPriv) }, &rsaKey.PublicKey, func(*http.Request) {}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "https://example.com/ap/acct/alice/inbox", nil)
+			err := tt.sign(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(r)
+
+			input, sig, err := ParseRequest(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !input.HasComponent("@method") || !input.HasComponent("@target-uri") || !input.HasComponent("content-digest") {
+				t.Fatalf("components %v", input.Components)
+			}
+
+			err = Verify(r, input, sig, tt.pub)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestComponentValueKeepsHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	r.Header.Add("X-Example", "  a ")
+	r.Header.Add("X-Example", "b  ")
+
+	value, err := componentValue(r, "x-example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "a, b" {
+		t.Fatalf("got %q", value)
+	}
+	if got := r.Header.Values("X-Example"); got[0] != "  a " || got[1] != "b  " {
+		t.Fatalf("request headers changed to %q", got)
+	}
+}
+
+func TestVerifyContentDigest(t *testing.T) {
+	body := []byte(`{"hello": "world"}`)
+
+	tests := []struct {
+		name    string
+		header  string
+		wantErr error
+		invalid bool
+	}{
+		// RFC 9530 appendix B.1
+		{"sha-256", "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", nil, false},
+		{"sha-512", "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:", nil, false},
+		{"unknown first", "md5=:AAAA:, sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:", nil, false},
+		{"mismatch", "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, 32)) + ":", ErrDigestMismatch, false},
+		{"unsupported", "md5=:AAAA:", ErrDigestUnsupported, false},
+		{"not a byte sequence", "sha-256=X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyContentDigest(tt.header, body)
+			switch {
+			case tt.invalid:
+				if err == nil || err == ErrDigestMismatch || err == ErrDigestUnsupported {
+					t.Fatalf("err = %v, want a parse error", err)
+				}
+			case err != tt.wantErr:
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if got := ContentDigest(body); got != "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:" {
+		t.Fatalf("ContentDigest = %s", got)
+	}
+}
@@ -0,0 +1,323 @@
+package store
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// sealedPrefix marks private keys encrypted by a Keyring.
+// Sealed keys look like "enc:v1:<master key id>:<wrapped data key>:<ciphertext>".
+// The ciphertext is bound to the entity and column it is stored in, so a sealed key
+// copied into another row does not decrypt.
+const sealedPrefix = "enc:v1:"
+
+const (
+	columnPrivatekey        = "privatekey"
+	columnEd25519Privatekey = "ed25519_privatekey"
+)
+
+// additionalData binds a ciphertext to the entity and column it is stored in.
+func additionalData(entityID, column string) []byte {
+	return []byte(entityID + "\x00" + column)
+}
+
+type masterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// Keyring encrypts private keys at rest with per-key data keys wrapped by a master key.
+// Retired master keys are kept for decryption only so the master key can be rotated.
+type Keyring struct {
+	current *masterKey
+	keys    map[string]*masterKey
+}
+
+// NewKeyring loads the master keys from the config.
+// It returns nil when no master key is configured, in which case keys are stored as-is.
+func NewKeyring(config types.KeyEncryptionConfig) (*Keyring, error) {
+	current := trimNewline(config.MasterKey)
+	if config.MasterKeyFile != "" {
+		content, err := os.ReadFile(config.MasterKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		current = trimNewline(string(content))
+	}
+
+	previous := make([]string, 0, len(config.PreviousMasterKeys))
+	for _, key := range config.PreviousMasterKeys {
+		previous = append(previous, trimNewline(key))
+	}
+	for _, file := range config.PreviousMasterKeyFiles {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		previous = append(previous, trimNewline(string(content)))
+	}
+
+	if current == "" {
+		if len(previous) > 0 {
+			return nil, fmt.Errorf("previous master keys are configured without a current one")
+		}
+		return nil, nil
+	}
+
+	keyring := &Keyring{
+		keys: make(map[string]*masterKey),
+	}
+
+	for i, encoded := range append([]string{current}, previous...) {
+		key, err := parseMasterKey(encoded)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			keyring.current = key
+		}
+		keyring.keys[key.id] = key
+	}
+
+	return keyring, nil
+}
+
+// trimNewline drops the line break editors and `echo` leave after a key.
+func trimNewline(s string) string {
+	return strings.TrimRight(s, "\r\n")
+}
+
+// parseMasterKey accepts a base64 encoded or raw 32 byte AES-256 key.
+func parseMasterKey(encoded string) (*masterKey, error) {
+	raw := []byte(encoded)
+	trimmed := strings.TrimSpace(encoded)
+	if decoded, err := base64.StdEncoding.DecodeString(trimmed); err == nil && len(decoded) == 32 {
+		raw = decoded
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes")
+	}
+
+	aead, err := newAEAD(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(raw)
+	return &masterKey{
+		id:   hex.EncodeToString(sum[:4]),
+		aead: aead,
+	}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// Seal encrypts a PEM encoded private key stored in column of the entity.
+// Already sealed values are returned unchanged.
+func (k *Keyring) Seal(plaintext, entityID, column string) (string, error) {
+	if k == nil || plaintext == "" || strings.HasPrefix(plaintext, sealedPrefix) {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, 32)
+	_, err := rand.Read(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataAEAD, []byte(plaintext), additionalData(entityID, column))
+	if err != nil {
+		return "", err
+	}
+
+	return k.wrap(dataKey, ciphertext)
+}
+
+func (k *Keyring) wrap(dataKey, ciphertext []byte) (string, error) {
+	wrapped, err := seal(k.current.aead, dataKey, []byte(k.current.id))
+	if err != nil {
+		return "", err
+	}
+
+	return sealedPrefix + k.current.id + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// unwrap returns the master key id, the data key and the ciphertext of a sealed value.
+func (k *Keyring) unwrap(sealed string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(sealed, sealedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed sealed key")
+	}
+
+	if k == nil {
+		return "", nil, nil, fmt.Errorf("key is encrypted but no master key is configured")
+	}
+
+	key, ok := k.keys[parts[0]]
+	if !ok {
+		return "", nil, nil, fmt.Errorf("unknown master key %s", parts[0])
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	dataKey, err := open(key.aead, wrapped, []byte(key.id))
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	return key.id, dataKey, ciphertext, nil
+}
+
+// Open decrypts a private key sealed for column of the entity.
+// Plain PEM values from before encryption was enabled are returned unchanged.
+func (k *Keyring) Open(sealed, entityID, column string) (string, error) {
+	if !strings.HasPrefix(sealed, sealedPrefix) {
+		return sealed, nil
+	}
+
+	_, dataKey, ciphertext, err := k.unwrap(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataAEAD, ciphertext, additionalData(entityID, column))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt key: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// rewrap seals plain values and wraps data keys of retired master keys with the current one.
+// Only the data key is re-encrypted, the private key ciphertext is kept.
+func (k *Keyring) rewrap(value, entityID, column string) (string, error) {
+	if value == "" {
+		return value, nil
+	}
+	if !strings.HasPrefix(value, sealedPrefix) {
+		return k.Seal(value, entityID, column)
+	}
+
+	id, dataKey, ciphertext, err := k.unwrap(value)
+	if err != nil {
+		return "", err
+	}
+	if id == k.current.id {
+		return value, nil
+	}
+
+	return k.wrap(dataKey, ciphertext)
+}
+
+// sealEntity encrypts the private keys of an entity about to be written.
+func (s Store) sealEntity(entity types.ApEntity) (types.ApEntity, error) {
+	var err error
+	entity.Privatekey, err = s.keyring.Seal(entity.Privatekey, entity.ID, columnPrivatekey)
+	if err != nil {
+		return entity, err
+	}
+	entity.Ed25519Privatekey, err = s.keyring.Seal(entity.Ed25519Privatekey, entity.ID, columnEd25519Privatekey)
+	return entity, err
+}
+
+// EncryptKeys encrypts every stored private key with the current master key.
+// It seals keys stored before encryption was enabled and rewraps keys sealed with a retired master key.
+func (s *Store) EncryptKeys(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "StoreEncryptKeys")
+	defer span.End()
+
+	if s.keyring == nil {
+		return 0, fmt.Errorf("no master key is configured")
+	}
+
+	var entities []types.ApEntity
+	err := s.db.WithContext(ctx).Find(&entities).Error
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
+	updated := 0
+	for _, entity := range entities {
+		privateKey, err := s.keyring.rewrap(entity.Privatekey, entity.ID, columnPrivatekey)
+		if err != nil {
+			return updated, fmt.Errorf("%s: %w", entity.ID, err)
+		}
+		ed25519Key, err := s.keyring.rewrap(entity.Ed25519Privatekey, entity.ID, columnEd25519Privatekey)
+		if err != nil {
+			return updated, fmt.Errorf("%s: %w", entity.ID, err)
+		}
+
+		if privateKey == entity.Privatekey && ed25519Key == entity.Ed25519Privatekey {
+			continue
+		}
+
+		// skip rows whose keys changed under us; they are written sealed anyway
+		result := s.db.WithContext(ctx).
+			Model(&types.ApEntity{}).
+			Where("id = ? AND privatekey = ? AND COALESCE(ed25519_privatekey, '') = ?", entity.ID, entity.Privatekey, entity.Ed25519Privatekey).
+			Updates(map[string]any{
+				"privatekey":         privateKey,
+				"ed25519_privatekey": ed25519Key,
+			})
+		if result.Error != nil {
+			span.RecordError(result.Error)
+			return updated, result.Error
+		}
+		updated += int(result.RowsAffected)
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,227 @@
+package store
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// KeyFragment returns the fragment of the RSA key id for a key version.
+// The first key keeps the historical "#main-key" so existing caches stay valid.
+func KeyFragment(version int) string {
+	if version == 0 {
+		return "#main-key"
+	}
+	return fmt.Sprintf("#main-key-v%d", version)
+}
+
+// Ed25519KeyFragment returns the fragment of the Ed25519 key id for a key version.
+func Ed25519KeyFragment(version int) string {
+	if version == 0 {
+		return "#ed25519-key"
+	}
+	return fmt.Sprintf("#ed25519-key-v%d", version)
+}
+
+// LoadKey decrypts and parses the RSA private key of the entity.
+func (s *Store) LoadKey(ctx context.Context, entity types.ApEntity) (*rsa.PrivateKey, error) {
+	privKeyPEM, err := s.keyring.Open(entity.Privatekey, entity.ID, columnPrivatekey)
+	if err != nil {
+		return &rsa.PrivateKey{}, err
+	}
+
+	block, _ := pem.Decode([]byte(privKeyPEM))
+	if block == nil {
+		return &rsa.PrivateKey{}, fmt.Errorf("failed to parse PEM block containing the key")
+	}
+
+	priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		return &rsa.PrivateKey{}, fmt.Errorf("failed to parse DER encoded private key: %w", err)
+	}
+
+	return priv, nil
+}
+
+// GenerateKeyPair generates a new RSA key pair and returns it as PEM strings.
+func GenerateKeyPair() (string, string, error) {
+	privKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	privKeyPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(privKey),
+		},
+	)
+
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(&privKey.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	pubKeyPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: pubKeyBytes,
+		},
+	)
+
+	return string(pubKeyPEM), string(privKeyPEM), nil
+}
+
+// GenerateEd25519KeyPair generates a new Ed25519 key pair and returns it as PEM strings.
+func GenerateEd25519KeyPair() (string, string, error) {
+	pubKey, privKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+
+	privKeyBytes, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return "", "", err
+	}
+	privKeyPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: privKeyBytes,
+		},
+	)
+
+	pubKeyBytes, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", "", err
+	}
+	pubKeyPEM := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: pubKeyBytes,
+		},
+	)
+
+	return string(pubKeyPEM), string(privKeyPEM), nil
+}
+
+// LoadEd25519Key decrypts and parses the Ed25519 private key of the entity.
+func (s *Store) LoadEd25519Key(ctx context.Context, entity types.ApEntity) (ed25519.PrivateKey, error) {
+	privKeyPEM, err := s.keyring.Open(entity.Ed25519Privatekey, entity.ID, columnEd25519Privatekey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(privKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block containing the key")
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DER encoded private key: %w", err)
+	}
+
+	edPriv, ok := priv.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ed25519 private key")
+	}
+
+	return edPriv, nil
+}
+
+// EnsureEd25519Key provisions an Ed25519 key pair for entities created before it was introduced.
+func (s *Store) EnsureEd25519Key(ctx context.Context, entity types.ApEntity) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreEnsureEd25519Key")
+	defer span.End()
+
+	if entity.Ed25519Privatekey != "" {
+		return entity, nil
+	}
+
+	pubKeyPEM, privKeyPEM, err := GenerateEd25519KeyPair()
+	if err != nil {
+		return entity, err
+	}
+
+	privKeyPEM, err = s.keyring.Seal(privKeyPEM, entity.ID, columnEd25519Privatekey)
+	if err != nil {
+		return entity, err
+	}
+
+	// only fill in the key if no other request did it in the meantime
+	result := s.db.WithContext(ctx).
+		Model(&types.ApEntity{}).
+		Where("id = ? AND (ed25519_privatekey IS NULL OR ed25519_privatekey = '')", entity.ID).
+		Updates(map[string]any{
+			"ed25519_publickey":  pubKeyPEM,
+			"ed25519_privatekey": privKeyPEM,
+		})
+	if result.Error != nil {
+		return entity, result.Error
+	}
+
+	return s.GetEntityByID(ctx, entity.ID)
+}
+
+// RotateKey replaces the RSA and Ed25519 key pairs of the entity.
+// The previous public keys are kept until grace has passed so in-flight signatures still verify.
+func (s *Store) RotateKey(ctx context.Context, entity types.ApEntity, grace time.Duration) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreRotateKey")
+	defer span.End()
+
+	pubKeyPEM, privKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return entity, err
+	}
+
+	privKeyPEM, err = s.keyring.Seal(privKeyPEM, entity.ID, columnPrivatekey)
+	if err != nil {
+		span.RecordError(err)
+		return entity, err
+	}
+
+	edPubKeyPEM, edPrivKeyPEM, err := GenerateEd25519KeyPair()
+	if err != nil {
+		span.RecordError(err)
+		return entity, err
+	}
+
+	edPrivKeyPEM, err = s.keyring.Seal(edPrivKeyPEM, entity.ID, columnEd25519Privatekey)
+	if err != nil {
+		span.RecordError(err)
+		return entity, err
+	}
+
+	expiresAt := time.Now().Add(grace)
+
+	// guard against concurrent rotations
+	result := s.db.WithContext(ctx).
+		Model(&types.ApEntity{}).
+		Where("id = ? AND key_version = ?", entity.ID, entity.KeyVersion).
+		Updates(map[string]any{
+			"publickey":                  pubKeyPEM,
+			"privatekey":                 privKeyPEM,
+			"key_version":                entity.KeyVersion + 1,
+			"ed25519_publickey":          edPubKeyPEM,
+			"ed25519_privatekey":         edPrivKeyPEM,
+			"previous_publickey":         entity.Publickey,
+			"previous_ed25519_publickey": entity.Ed25519Publickey,
+			"previous_key_expires_at":    expiresAt,
+		})
+	if result.Error != nil {
+		span.RecordError(result.Error)
+		return entity, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return entity, fmt.Errorf("key of %s was rotated concurrently", entity.ID)
+	}
+
+	return s.GetEntityByID(ctx, entity.ID)
+}
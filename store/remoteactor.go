@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// failed fetches are backed off up to 2^maxRemoteActorBackoffExponent times the retry interval
+const maxRemoteActorBackoffExponent = 7
+
+// GetRemoteActor returns a remote actor by the URL it was fetched from
+func (s *Store) GetRemoteActor(ctx context.Context, id string) (types.RemoteActor, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetRemoteActor")
+	defer span.End()
+
+	var actor types.RemoteActor
+	result := s.db.WithContext(ctx).Where("id = ?", id).First(&actor)
+	return actor, result.Error
+}
+
+// UpsertRemoteActor saves a remote actor
+func (s *Store) UpsertRemoteActor(ctx context.Context, actor types.RemoteActor) error {
+	ctx, span := tracer.Start(ctx, "StoreUpsertRemoteActor")
+	defer span.End()
+
+	return s.db.WithContext(ctx).Save(&actor).Error
+}
+
+// RecordRemoteActorFailure records a failed fetch of a remote actor.
+// Actors that were never fetched get a placeholder row so that they are backed off as well.
+func (s *Store) RecordRemoteActorFailure(ctx context.Context, id string, at time.Time) error {
+	ctx, span := tracer.Start(ctx, "StoreRecordRemoteActorFailure")
+	defer span.End()
+
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"last_attempt_at": at,
+			"failure_count":   gorm.Expr("remote_actors.failure_count + 1"),
+		}),
+	}).Create(&types.RemoteActor{
+		ID:            id,
+		Document:      "{}",
+		LastAttemptAt: at,
+		FailureCount:  1,
+	}).Error
+}
+
+// GetStaleRemoteActors returns remote actors fetched before fetchedBefore whose retry backoff has expired,
+// least recently attempted first. The backoff starts at retryInterval and doubles with every failure.
+func (s *Store) GetStaleRemoteActors(ctx context.Context, fetchedBefore time.Time, retryInterval time.Duration, limit int) ([]types.RemoteActor, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetStaleRemoteActors")
+	defer span.End()
+
+	var actors []types.RemoteActor
+	err := s.db.WithContext(ctx).
+		Where("fetched_at < ?", fetchedBefore).
+		Where("last_attempt_at < NOW() - make_interval(secs => ? * power(2, LEAST(failure_count, ?)))", retryInterval.Seconds(), maxRemoteActorBackoffExponent).
+		Order("last_attempt_at").
+		Limit(limit).
+		Find(&actors).Error
+	return actors, err
+}
+
+// createRemoteActorPlaceholder makes sure a remote actor row exists for follows and followers to reference.
+// Placeholders have no fetch time, so the remote actor worker fills them in first.
+func createRemoteActorPlaceholder(tx *gorm.DB, id string) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&types.RemoteActor{
+		ID:       id,
+		Document: "{}",
+	}).Error
+}
+
+// LinkRemoteActors points up to limit actors of follows and followers recorded before they referenced
+// the remote_actors table at their remote actor rows, creating placeholders where needed.
+func (s *Store) LinkRemoteActors(ctx context.Context, limit int) error {
+	ctx, span := tracer.Start(ctx, "StoreLinkRemoteActors")
+	defer span.End()
+
+	var ids []string
+	err := s.db.WithContext(ctx).Raw(`
+		SELECT publisher_person_url AS id FROM ap_follows WHERE remote_actor_id IS NULL
+		UNION
+		SELECT subscriber_person_url AS id FROM ap_followers WHERE remote_actor_id IS NULL
+		ORDER BY id
+		LIMIT ?`, limit).Scan(&ids).Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := createRemoteActorPlaceholder(tx, id)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&types.ApFollow{}).Where("publisher_person_url = ? AND remote_actor_id IS NULL", id).Update("remote_actor_id", id).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&types.ApFollower{}).Where("subscriber_person_url = ? AND remote_actor_id IS NULL", id).Update("remote_actor_id", id).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -2,10 +2,6 @@ package store
 
 import (
 	"context"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
-	"fmt"
 	"gorm.io/gorm"
 
 	"go.opentelemetry.io/otel"
@@ -15,14 +11,18 @@ import (
 
 var tracer = otel.Tracer("store")
 
+const publicAddress = "https://www.w3.org/ns/activitystreams#Public"
+
 // Store is a repository for ActivityPub.
 type Store struct {
-	db *gorm.DB
+	db      *gorm.DB
+	keyring *Keyring
 }
 
 // NewStore returns a new Store.
-func NewStore(db *gorm.DB) *Store {
-	return &Store{db: db}
+// Private keys are encrypted at rest when keyring is not nil.
+func NewStore(db *gorm.DB, keyring *Keyring) *Store {
+	return &Store{db: db, keyring: keyring}
 }
 
 func (s Store) GetUserSettings(ctx context.Context, id string) (types.ApUserSettings, error) {
@@ -46,10 +46,58 @@ func (s Store) GetAllEntities(ctx context.Context) ([]types.ApEntity, error) {
 	defer span.End()
 
 	var entities []types.ApEntity
-	err := s.db.WithContext(ctx).Where("enabled = ?", true).Find(&entities).Error
+	err := s.db.WithContext(ctx).Where("enabled = ? AND COALESCE(parent_id, '') = '' AND COALESCE(timeline_id, '') = ''", true).Find(&entities).Error
+	return entities, err
+}
+
+// GetGroupEntities returns the Group actors of community timelines.
+func (s Store) GetGroupEntities(ctx context.Context) ([]types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetGroupEntities")
+	defer span.End()
+
+	var entities []types.ApEntity
+	err := s.db.WithContext(ctx).Where("enabled = ? AND COALESCE(timeline_id, '') != ''", true).Find(&entities).Error
+	return entities, err
+}
+
+// GetSubprofileEntities returns the subprofile actors of an entity.
+func (s Store) GetSubprofileEntities(ctx context.Context, parentID string) ([]types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetSubprofileEntities")
+	defer span.End()
+
+	var entities []types.ApEntity
+	err := s.db.WithContext(ctx).Where("parent_id = ?", parentID).Find(&entities).Error
 	return entities, err
 }
 
+// GetSubprofileEntity returns the subprofile actor of an entity bound to a Concrnt profile.
+func (s Store) GetSubprofileEntity(ctx context.Context, parentID, profileID string) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetSubprofileEntity")
+	defer span.End()
+
+	var entity types.ApEntity
+	result := s.db.WithContext(ctx).Where("parent_id = ? AND profile_id = ?", parentID, profileID).First(&entity)
+	return entity, result.Error
+}
+
+// DeleteEntity deletes an entity along with its follows and followers.
+func (s Store) DeleteEntity(ctx context.Context, id string) error {
+	ctx, span := tracer.Start(ctx, "StoreDeleteEntity")
+	defer span.End()
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("subscriber_user_id = ?", id).Delete(&types.ApFollow{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Where("publisher_user_id = ?", id).Delete(&types.ApFollower{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("id = ?", id).Delete(&types.ApEntity{}).Error
+	})
+}
+
 // GetEntityByID returns an entity by ID.
 func (s Store) GetEntityByID(ctx context.Context, id string) (types.ApEntity, error) {
 	ctx, span := tracer.Start(ctx, "StoreGetEntityByID")
@@ -60,13 +108,13 @@ func (s Store) GetEntityByID(ctx context.Context, id string) (types.ApEntity, er
 	return entity, result.Error
 }
 
-// GetEntityByCCID returns an entity by CCiD.
+// GetEntityByCCID returns the main entity of a CCiD.
 func (s Store) GetEntityByCCID(ctx context.Context, ccid string) (types.ApEntity, error) {
 	ctx, span := tracer.Start(ctx, "StoreGetEntityByCCID")
 	defer span.End()
 
 	var entity types.ApEntity
-	result := s.db.WithContext(ctx).Where("cc_id = ?", ccid).First(&entity)
+	result := s.db.WithContext(ctx).Where("cc_id = ? AND COALESCE(parent_id, '') = ''", ccid).First(&entity)
 	return entity, result.Error
 }
 
@@ -75,10 +123,31 @@ func (s Store) CreateEntity(ctx context.Context, entity types.ApEntity) (types.A
 	ctx, span := tracer.Start(ctx, "StoreCreateEntity")
 	defer span.End()
 
+	var err error
+	entity, err = s.sealEntity(entity)
+	if err != nil {
+		return entity, err
+	}
+
 	result := s.db.WithContext(ctx).Create(&entity)
 	return entity, result.Error
 }
 
+// UpdateEntity updates an entity.
+func (s Store) UpdateEntity(ctx context.Context, entity types.ApEntity) (types.ApEntity, error) {
+	ctx, span := tracer.Start(ctx, "StoreUpdateEntity")
+	defer span.End()
+
+	var err error
+	entity, err = s.sealEntity(entity)
+	if err != nil {
+		return entity, err
+	}
+
+	result := s.db.WithContext(ctx).Save(&entity)
+	return entity, result.Error
+}
+
 func (s Store) UpdateEntityAliases(ctx context.Context, id string, aliases []string) (types.ApEntity, error) {
 	ctx, span := tracer.Start(ctx, "StoreUpdateEntityAliases")
 	defer span.End()
@@ -99,7 +168,14 @@ func (s *Store) SaveFollower(ctx context.Context, follower types.ApFollower) err
 	ctx, span := tracer.Start(ctx, "StoreSaveFollow")
 	defer span.End()
 
-	return s.db.WithContext(ctx).Create(&follower).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := createRemoteActorPlaceholder(tx, follower.SubscriberPersonURL)
+		if err != nil {
+			return err
+		}
+		follower.RemoteActorID = &follower.SubscriberPersonURL
+		return tx.Create(&follower).Error
+	})
 }
 
 // SaveFollowing saves follow action
@@ -107,7 +183,14 @@ func (s *Store) SaveFollow(ctx context.Context, follow types.ApFollow) error {
 	ctx, span := tracer.Start(ctx, "StoreSaveFollow")
 	defer span.End()
 
-	return s.db.WithContext(ctx).Create(&follow).Error
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := createRemoteActorPlaceholder(tx, follow.PublisherPersonURL)
+		if err != nil {
+			return err
+		}
+		follow.RemoteActorID = &follow.PublisherPersonURL
+		return tx.Create(&follow).Error
+	})
 }
 
 // GetFollows returns owners follows
@@ -130,6 +213,46 @@ func (s *Store) GetFollowers(ctx context.Context, ownerID string) ([]types.ApFol
 	return followers, err
 }
 
+// CountFollowers returns the number of owners followers
+func (s *Store) CountFollowers(ctx context.Context, ownerID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "StoreCountFollowers")
+	defer span.End()
+
+	var count int64
+	err := s.db.WithContext(ctx).Model(&types.ApFollower{}).Where("publisher_user_id = ?", ownerID).Count(&count).Error
+	return count, err
+}
+
+// GetFollowersPage returns a page of owners followers
+func (s *Store) GetFollowersPage(ctx context.Context, ownerID string, offset, limit int) ([]types.ApFollower, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetFollowersPage")
+	defer span.End()
+
+	var followers []types.ApFollower
+	err := s.db.WithContext(ctx).Where("publisher_user_id = ?", ownerID).Order("subscriber_person_url").Offset(offset).Limit(limit).Find(&followers).Error
+	return followers, err
+}
+
+// CountFollows returns the number of owners accepted follows
+func (s *Store) CountFollows(ctx context.Context, ownerID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "StoreCountFollows")
+	defer span.End()
+
+	var count int64
+	err := s.db.WithContext(ctx).Model(&types.ApFollow{}).Where("subscriber_user_id = ? AND accepted = true", ownerID).Count(&count).Error
+	return count, err
+}
+
+// GetFollowsPage returns a page of owners accepted follows
+func (s *Store) GetFollowsPage(ctx context.Context, ownerID string, offset, limit int) ([]types.ApFollow, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetFollowsPage")
+	defer span.End()
+
+	var follows []types.ApFollow
+	err := s.db.WithContext(ctx).Where("subscriber_user_id = ? AND accepted = true", ownerID).Order("publisher_person_url").Offset(offset).Limit(limit).Find(&follows).Error
+	return follows, err
+}
+
 // GetFollowsByPublisher returns follows by publisher
 func (s *Store) GetFollowsByPublisher(ctx context.Context, publisher string) ([]types.ApFollow, error) {
 	ctx, span := tracer.Start(ctx, "StoreGetFollowsByPublisher")
@@ -267,16 +390,41 @@ func (s *Store) DeleteApObjectReference(ctx context.Context, ApObjectID string)
 	return s.db.WithContext(ctx).Where("ap_object_id = ?", ApObjectID).Delete(&types.ApObjectReference{}).Error
 }
 
-func (s *Store) LoadKey(ctx context.Context, entity types.ApEntity) (*rsa.PrivateKey, error) {
-	block, _ := pem.Decode([]byte(entity.Privatekey))
-	if block == nil {
-		return &rsa.PrivateKey{}, fmt.Errorf("failed to parse PEM block containing the key")
-	}
+// SaveSentNote records the actor a message was delivered as
+func (s *Store) SaveSentNote(ctx context.Context, note types.ApSentNote) error {
+	ctx, span := tracer.Start(ctx, "StoreSaveSentNote")
+	defer span.End()
 
-	priv, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-	if err != nil {
-		return &rsa.PrivateKey{}, fmt.Errorf("failed to parse DER encoded private key: " + err.Error())
-	}
+	return s.db.WithContext(ctx).Save(&note).Error
+}
+
+// GetSentNote returns the delivery record of a message
+func (s *Store) GetSentNote(ctx context.Context, messageID string) (types.ApSentNote, error) {
+	ctx, span := tracer.Start(ctx, "StoreGetSentNote")
+	defer span.End()
+
+	var note types.ApSentNote
+	err := s.db.WithContext(ctx).Where("message_id = ?", messageID).First(&note).Error
+	return note, err
+}
+
+// DeleteSentNote deletes the delivery record of a message
+func (s *Store) DeleteSentNote(ctx context.Context, messageID string) error {
+	ctx, span := tracer.Start(ctx, "StoreDeleteSentNote")
+	defer span.End()
+
+	return s.db.WithContext(ctx).Where("message_id = ?", messageID).Delete(&types.ApSentNote{}).Error
+}
+
+// CountPublicSentNotes returns the number of public and unlisted notes delivered as an entity
+func (s *Store) CountPublicSentNotes(ctx context.Context, entityID string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "StoreCountPublicSentNotes")
+	defer span.End()
 
-	return priv, nil
+	var count int64
+	err := s.db.WithContext(ctx).
+		Model(&types.ApSentNote{}).
+		Where("entity_id = ? AND (? = ANY(\"to\") OR ? = ANY(cc))", entityID, publicAddress, publicAddress).
+		Count(&count).Error
+	return count, err
 }
@@ -1,6 +1,8 @@
 package types
 
 import (
+	"time"
+
 	"github.com/lib/pq"
 )
 
@@ -12,6 +14,22 @@ type ApEntity struct {
 	Publickey   string         `json:"publickey" gorm:"type:text"`
 	Privatekey  string         `json:"privatekey" gorm:"type:text"`
 	AlsoKnownAs pq.StringArray `json:"aliases" gorm:"type:text[]"`
+
+	Ed25519Publickey  string `json:"ed25519publickey" gorm:"type:text"`
+	Ed25519Privatekey string `json:"ed25519privatekey" gorm:"type:text"`
+
+	// KeyVersion is bumped on every key rotation; the previous public keys stay published until PreviousKeyExpiresAt.
+	KeyVersion               int        `json:"key_version" gorm:"type:integer;default:0"`
+	PreviousPublickey        string     `json:"previous_publickey" gorm:"type:text"`
+	PreviousEd25519Publickey string     `json:"previous_ed25519publickey" gorm:"type:text"`
+	PreviousKeyExpiresAt     *time.Time `json:"previous_key_expires_at"`
+
+	// subprofile actors (e.g. characters) point to the main entity of the same user
+	ParentID  string `json:"parent_id" gorm:"type:text;default:''"`
+	ProfileID string `json:"profile_id" gorm:"type:text"`
+
+	// community timelines are published as Group actors
+	TimelineID string `json:"timeline_id" gorm:"type:text"`
 }
 
 // ApFollow is a db model of an ActivityPub follow.
@@ -21,6 +39,10 @@ type ApFollow struct {
 	Accepted           bool   `json:"accepted" gorm:"type:bool"`
 	PublisherPersonURL string `json:"publisher" gorm:"type:text"`  // ActivityPub Person
 	SubscriberUserID   string `json:"subscriber" gorm:"type:text"` // Concurrent APID
+
+	// RemoteActorID is the remote actor of the publisher; it is only empty for follows recorded before the column existed
+	RemoteActorID *string      `json:"-" gorm:"type:text;index"`
+	RemoteActor   *RemoteActor `json:"-" gorm:"foreignKey:RemoteActorID"`
 }
 
 // ApFollwer is a db model of an ActivityPub follower.
@@ -30,6 +52,26 @@ type ApFollower struct {
 	SubscriberPersonURL string `json:"subscriber" gorm:"type:text;uniqueIndex:uniq_apfollower;"` // ActivityPub Person
 	PublisherUserID     string `json:"publisher" gorm:"type:text;uniqueIndex:uniq_apfollower;"`  // Concurrent APID
 	SubscriberInbox     string `json:"subscriber_inbox" gorm:"type:text"`                        // ActivityPub Inbox
+
+	// RemoteActorID is the remote actor of the subscriber; it is only empty for followers recorded before the column existed
+	RemoteActorID *string      `json:"-" gorm:"type:text;index"`
+	RemoteActor   *RemoteActor `json:"-" gorm:"foreignKey:RemoteActorID"`
+}
+
+// RemoteActor is a db model of a remote ActivityPub actor.
+// It keeps the last fetched document so actors survive cache evictions, and is refreshed in the background.
+type RemoteActor struct {
+	ID            string    `json:"id" gorm:"type:text;primaryKey"`
+	URL           string    `json:"url" gorm:"type:text;index"`
+	Handle        string    `json:"handle" gorm:"type:text;index"` // user@host
+	Inbox         string    `json:"inbox" gorm:"type:text"`
+	SharedInbox   string    `json:"shared_inbox" gorm:"type:text"`
+	KeyID         string    `json:"key_id" gorm:"type:text"`
+	PublicKeyPem  string    `json:"public_key_pem" gorm:"type:text"`
+	Document      string    `json:"document" gorm:"type:jsonb"`
+	FetchedAt     time.Time `json:"fetched_at" gorm:"index"`
+	LastAttemptAt time.Time `json:"last_attempt_at" gorm:"index"`
+	FailureCount  int       `json:"failure_count" gorm:"type:integer;default:0"`
 }
 
 // ApObjectReference is a db model of an ActivityPub object cross reference.
@@ -38,7 +80,29 @@ type ApObjectReference struct {
 	CcObjectID string `json:"ccobjectID" gorm:"type:text;"`
 }
 
+// ApSentNote is a db model of a Concrnt message delivered as a Note.
+// It remembers the actor and the audience it was sent to so that the Delete reaches the same recipients.
+type ApSentNote struct {
+	MessageID string         `json:"messageID" gorm:"primaryKey;type:text;"`
+	EntityID  string         `json:"entityID" gorm:"type:text;index"`
+	To        pq.StringArray `json:"to" gorm:"type:text[]"`
+	CC        pq.StringArray `json:"cc" gorm:"type:text[]"`
+	CDate     time.Time      `json:"cdate" gorm:"type:timestamp with time zone;not null;default:clock_timestamp()"`
+}
+
 type ApUserSettings struct {
-	CCID            string         `json:"ccid" gorm:"type:char(42);primaryKey"`
-	ListenTimelines pq.StringArray `json:"listen_timelines" gorm:"type:text[]"`
+	CCID              string         `json:"ccid" gorm:"type:char(42);primaryKey"`
+	ListenTimelines   pq.StringArray `json:"listen_timelines" gorm:"type:text[]"`
+	ProfileFields     []ProfileField `json:"profile_fields" gorm:"type:jsonb;serializer:json"`
+	Discoverable      *bool          `json:"discoverable"`                          // defaults to true
+	Indexable         *bool          `json:"indexable"`                             // defaults to the indexable flag of the home timeline
+	HideNetwork       bool           `json:"hide_network"`                          // publish only the counts of followers and following
+	PinnedMessages    pq.StringArray `json:"pinned_messages" gorm:"type:text[]"`    // message IDs published in the featured collection
+	UnlistedTimelines pq.StringArray `json:"unlisted_timelines" gorm:"type:text[]"` // posts to these timelines go out unlisted
+}
+
+// ProfileField is a key/value pair shown on the profile, published as a PropertyValue.
+type ProfileField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
 }
@@ -80,14 +80,20 @@ type ApObject struct {
 	Endpoints         *PersonEndpoints `json:"endpoints,omitempty"`
 	Followers         string           `json:"followers,omitempty"`
 	Following         string           `json:"following,omitempty"`
+	Featured          string           `json:"featured,omitempty"`
 	Liked             string           `json:"liked,omitempty"`
 	PreferredUsername string           `json:"preferredUsername,omitempty"`
 	Name              string           `json:"name,omitempty"`
 	Summary           string           `json:"summary,omitempty"`
 	URL               string           `json:"url,omitempty"`
 	Icon              *Icon            `json:"icon,omitempty"`
-	PublicKey         *Key             `json:"publicKey,omitempty"`
+	Image             *Icon            `json:"image,omitempty"`
+	Discoverable      *bool            `json:"discoverable,omitempty"`
+	Indexable         *bool            `json:"indexable,omitempty"`
+	PublicKey         any              `json:"publicKey,omitempty"`
+	AssertionMethod   []Multikey       `json:"assertionMethod,omitempty"`
 	Object            any              `json:"object,omitempty"`
+	Target            string           `json:"target,omitempty"`
 	Sensitive         bool             `json:"sensitive,omitempty"`
 	AlsoKnownAs       []string         `json:"alsoKnownAs,omitempty"`
 }
@@ -104,6 +110,14 @@ type Key struct {
 	PublicKeyPem string `json:"publicKeyPem,omitempty"`
 }
 
+// Multikey is a struct for FEP-521a keys listed in assertionMethod.
+type Multikey struct {
+	ID                 string `json:"id,omitempty"`
+	Type               string `json:"type,omitempty"`
+	Controller         string `json:"controller,omitempty"`
+	PublicKeyMultibase string `json:"publicKeyMultibase,omitempty"`
+}
+
 // Icon is a struct for the icon field of an actor.
 type Icon struct {
 	Type      string `json:"type,omitempty"`
@@ -117,6 +131,8 @@ type Attachment struct {
 	MediaType string `json:"mediaType,omitempty"`
 	URL       string `json:"url,omitempty"`
 	Sensitive bool   `json:"sensitive,omitempty"`
+	Name      string `json:"name,omitempty"`  // PropertyValue
+	Value     string `json:"value,omitempty"` // PropertyValue
 }
 
 // Tag is a struct for an ActivityPub tag.
@@ -131,13 +147,40 @@ type Tag struct {
 // ---------------------------------------------------------------------
 
 type ApConfig struct {
-	FQDN      string `yaml:"fqdn"`
-	ProxyPriv string `yaml:"proxyPriv"`
+	FQDN      string          `yaml:"fqdn"`
+	ProxyPriv string          `yaml:"proxyPriv"`
+	RateLimit RateLimitConfig `yaml:"rateLimit"`
+	ClockSkew int             `yaml:"clockSkew"` // seconds, defaults to 300
+	KeyGrace  int             `yaml:"keyGrace"`  // seconds the previous key stays published after a rotation, defaults to 7 days
+
+	KeyEncryption KeyEncryptionConfig `yaml:"keyEncryption"`
 
 	// internal generated
 	ProxyCCID string
 }
 
+// KeyEncryptionConfig configures the master key that encrypts private keys at rest.
+// Keys are base64 encoded 32 byte AES keys, given inline or as files.
+// Retired master keys stay listed in PreviousMasterKeys until the keys are re-encrypted.
+type KeyEncryptionConfig struct {
+	MasterKey              string   `yaml:"masterKey"`
+	MasterKeyFile          string   `yaml:"masterKeyFile"`
+	PreviousMasterKeys     []string `yaml:"previousMasterKeys"`
+	PreviousMasterKeyFiles []string `yaml:"previousMasterKeyFiles"`
+}
+
+// RateLimitConfig is a token bucket configuration for inbound deliveries.
+// Rates are in requests per second, bursts are the bucket sizes.
+type RateLimitConfig struct {
+	Enabled     bool    `yaml:"enabled"`
+	IPRate      float64 `yaml:"ipRate"`
+	IPBurst     int     `yaml:"ipBurst"`
+	ActorRate   float64 `yaml:"actorRate"`
+	ActorBurst  int     `yaml:"actorBurst"`
+	DomainRate  float64 `yaml:"domainRate"`
+	DomainBurst int     `yaml:"domainBurst"`
+}
+
 type AccountStats struct {
 	Follows   []string `json:"follows"`
 	Followers []string `json:"followers"`
@@ -147,7 +190,7 @@ type OutboxIndex struct {
 	Context    any    `json:"@context,omitempty"`
 	ID         string `json:"id,omitempty"`
 	Type       string `json:"type,omitempty"`
-	TotalItems int    `json:"totalItems"`
+	TotalItems *int   `json:"totalItems,omitempty"`
 	First      string `json:"first,omitempty"`
 	Last       string `json:"last,omitempty"`
 }
@@ -161,3 +204,48 @@ type OutboxItems struct {
 	PartOf       string     `json:"partOf,omitempty"`
 	OrderedItems []ApObject `json:"orderedItems,omitempty"`
 }
+
+// Collection is an OrderedCollection of actor URLs such as followers and following.
+type Collection struct {
+	Context    any    `json:"@context,omitempty"`
+	ID         string `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	TotalItems int64  `json:"totalItems"`
+	First      string `json:"first,omitempty"`
+}
+
+// CollectionPage is a page of a Collection.
+type CollectionPage struct {
+	Context      any      `json:"@context,omitempty"`
+	ID           string   `json:"id,omitempty"`
+	Type         string   `json:"type,omitempty"`
+	TotalItems   int64    `json:"totalItems"`
+	PartOf       string   `json:"partOf,omitempty"`
+	Next         string   `json:"next,omitempty"`
+	Prev         string   `json:"prev,omitempty"`
+	OrderedItems []string `json:"orderedItems"`
+}
+
+// ObjectCollection is an OrderedCollection of embedded objects such as the featured posts.
+type ObjectCollection struct {
+	Context      any        `json:"@context,omitempty"`
+	ID           string     `json:"id,omitempty"`
+	Type         string     `json:"type,omitempty"`
+	TotalItems   int        `json:"totalItems"`
+	OrderedItems []ApObject `json:"orderedItems"`
+}
+
+// ---------------------------------------------------------------------
+
+// ProfileChannel is the redis channel the api announces the CCID of a user on when their actor may have changed.
+const ProfileChannel = "ap:profile"
+
+// FeaturedQueue is the redis list the api queues featured collection changes on.
+const FeaturedQueue = "ap:queue:featured"
+
+// FeaturedChange is a pin added to or removed from the featured collection, delivered by the worker.
+type FeaturedChange struct {
+	CCID      string `json:"ccid"`
+	Type      string `json:"type"` // Add or Remove
+	MessageID string `json:"messageID"`
+}
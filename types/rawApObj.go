@@ -32,8 +32,11 @@ func (r *RawApObj) get(key string) (any, bool) {
 		if value == nil {
 			return nil, false
 		}
-		var ok bool
-		value, ok = value.(map[string]any)[k]
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		value, ok = obj[k]
 		if !ok {
 			return nil, false
 		}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// StartFeaturedWorker delivers the Add and Remove activities for pins queued by the api.
+func (w *Worker) StartFeaturedWorker() {
+
+	log.Printf("start featured worker")
+
+	ctx := context.Background()
+
+	for {
+		result, err := w.rdb.BRPop(ctx, time.Minute, types.FeaturedQueue).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("worker/featured BRPop: %v", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		var change types.FeaturedChange
+		err = json.Unmarshal([]byte(result[1]), &change)
+		if err != nil {
+			log.Printf("worker/featured json.Unmarshal: %v", err)
+			continue
+		}
+
+		w.deliverFeaturedChange(ctx, change)
+	}
+}
+
+// deliverFeaturedChange sends the Add or Remove activity of a pin to the followers of its actor.
+func (w *Worker) deliverFeaturedChange(ctx context.Context, change types.FeaturedChange) {
+	entity, err := w.bridge.PinnedEntity(ctx, change.CCID, change.MessageID)
+	if err != nil {
+		// only notes that made it into the featured collection are added
+		if change.Type != "Remove" {
+			log.Printf("worker/featured/%v PinnedEntity %v", change.CCID, err)
+			return
+		}
+		// the message may be gone already; the main actor is the best guess
+		entity, err = w.store.GetEntityByCCID(ctx, change.CCID)
+		if err != nil {
+			log.Printf("worker/featured/%v GetEntityByCCID %v", change.CCID, err)
+			return
+		}
+	}
+
+	activity := w.bridge.FeaturedActivity(change.Type, change.MessageID, entity.ID)
+	err = w.apclient.DeliverToFollowers(ctx, activity, entity)
+	if err != nil {
+		log.Printf("worker/featured/%v DeliverToFollowers %v", entity.ID, err)
+	}
+}
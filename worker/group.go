@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/concrnt/concrnt/core"
+
+	"github.com/concrnt/ccworld-ap-bridge/bridge"
+	"github.com/concrnt/ccworld-ap-bridge/types"
+	"github.com/concrnt/ccworld-ap-bridge/world"
+)
+
+// StartGroupWorker announces posts of community timelines to the followers of their Group actors.
+func (w *Worker) StartGroupWorker() {
+
+	log.Printf("start group worker")
+
+	ctx := context.Background()
+	pubsub := w.rdb.Subscribe(ctx)
+
+	var mu sync.Mutex
+	groups := make(map[string]types.ApEntity)
+
+	go func() {
+		ticker := time.NewTicker(10 * time.Second)
+		for ; true; <-ticker.C {
+			entities, err := w.store.GetGroupEntities(ctx)
+			if err != nil {
+				log.Printf("worker/group GetGroupEntities: %v", err)
+				continue
+			}
+
+			current := make(map[string]types.ApEntity)
+			for _, entity := range entities {
+				current[entity.TimelineID+"@"+w.config.FQDN] = entity
+			}
+
+			mu.Lock()
+			for channel := range groups {
+				if _, ok := current[channel]; !ok {
+					err := pubsub.Unsubscribe(ctx, channel)
+					if err != nil {
+						log.Printf("worker/group Unsubscribe: %v", err)
+					}
+				}
+			}
+			for channel := range current {
+				if _, ok := groups[channel]; !ok {
+					err := pubsub.Subscribe(ctx, channel)
+					if err != nil {
+						log.Printf("worker/group Subscribe: %v", err)
+					}
+				}
+			}
+			groups = current
+			mu.Unlock()
+		}
+	}()
+
+	for {
+		pubsubMsg, err := pubsub.ReceiveMessage(ctx)
+		if err != nil {
+			log.Printf("worker/group ReceiveMessage: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		mu.Lock()
+		group, ok := groups[pubsubMsg.Channel]
+		mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		var streamEvent core.Event
+		err = json.Unmarshal([]byte(pubsubMsg.Payload), &streamEvent)
+		if err != nil {
+			log.Printf("worker/group/%v json.Unmarshal streamEvent %v", group.ID, err)
+			continue
+		}
+
+		var document core.DocumentBase[any]
+		err = json.Unmarshal([]byte(streamEvent.Document), &document)
+		if err != nil {
+			log.Printf("worker/group/%v json.Unmarshal document %v", group.ID, err)
+			continue
+		}
+
+		switch document.Type {
+		case "message":
+			if streamEvent.Item == nil {
+				continue
+			}
+
+			// whispers stay between their participants
+			if document.Policy == world.WhisperPolicyURL {
+				continue
+			}
+
+			// posts bridged from the fediverse are announced by the inbox,
+			// which knows their original id only after committing them
+			if document.Signer == w.config.ProxyCCID {
+				continue
+			}
+
+			// unlisted posts are kept out of community timelines
+			if meta, ok := document.Meta.(map[string]any); ok && meta["visibility"] == bridge.VisibilityUnlisted {
+				continue
+			}
+
+			go w.announceGroupPost(ctx, group, *streamEvent.Item)
+		case "delete":
+			var deleteDoc core.DeleteDocument
+			err = json.Unmarshal([]byte(streamEvent.Document), &deleteDoc)
+			if err != nil {
+				log.Printf("worker/group/%v json.Unmarshal deleteDoc %v", group.ID, err)
+				continue
+			}
+			if deleteDoc.Target == "" || deleteDoc.Target[0] != 'm' {
+				continue
+			}
+
+			go w.announceGroupDelete(ctx, group, deleteDoc.Target, document.Signer)
+		}
+	}
+}
+
+// announceGroupPost delivers the Announce of a post of the group's timeline to the group's followers.
+func (w *Worker) announceGroupPost(ctx context.Context, group types.ApEntity, item core.TimelineItem) {
+	announce, err := w.bridge.GroupAnnounce(ctx, group, item.ResourceID, item.CDate)
+	if err != nil {
+		log.Printf("worker/group/%v GroupAnnounce %v", group.ID, err)
+		return
+	}
+
+	err = w.apclient.DeliverToFollowers(ctx, announce, group)
+	if err != nil {
+		log.Printf("worker/group/%v DeliverToFollowers %v", group.ID, err)
+	}
+}
+
+// announceGroupDelete delivers the Announce of a deleted post of a bridged user to the group's followers.
+func (w *Worker) announceGroupDelete(ctx context.Context, group types.ApEntity, messageID, signer string) {
+	var actorID string
+	if sent, err := w.store.GetSentNote(ctx, messageID); err == nil {
+		actorID = sent.EntityID
+	} else if author, err := w.store.GetEntityByCCID(ctx, signer); err == nil {
+		actorID = author.ID
+	} else {
+		// the post never reached the fediverse
+		return
+	}
+
+	err := w.apclient.DeliverToFollowers(ctx, w.bridge.GroupDeleteAnnounce(group, messageID, actorID), group)
+	if err != nil {
+		log.Printf("worker/group/%v DeliverToFollowers %v", group.ID, err)
+	}
+}
@@ -39,4 +39,8 @@ func NewWorker(
 func (w *Worker) Run() {
 	go w.StartMessageWorker()
 	go w.StartAssociationWorker()
+	go w.StartProfileWorker()
+	go w.StartGroupWorker()
+	go w.StartRemoteActorWorker()
+	go w.StartFeaturedWorker()
 }
@@ -4,14 +4,14 @@ import (
 	"context"
 	"encoding/json"
 	"log"
-	"regexp"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/concrnt/concrnt/client"
 	"github.com/concrnt/concrnt/core"
 
-	"github.com/concrnt/ccworld-ap-bridge/apclient"
+	"github.com/concrnt/ccworld-ap-bridge/bridge"
 	"github.com/concrnt/ccworld-ap-bridge/types"
 	"github.com/concrnt/ccworld-ap-bridge/world"
 )
@@ -154,7 +154,9 @@ func (w *Worker) StartMessageWorker() {
 						}
 
 						var object *types.ApObject
-						var content string
+
+						// the actor the activity is sent as; characters have their own
+						sender := entity
 
 						switch document.Type {
 						case "message":
@@ -166,29 +168,19 @@ func (w *Worker) StartMessageWorker() {
 									continue
 								}
 
-								content = note.Content
-
-								if note.Type == "Announce" {
-									announce := types.ApObject{
-										Context: []string{"https://www.w3.org/ns/activitystreams"},
-										Type:    "Announce",
-										ID:      "https://" + w.config.FQDN + "/ap/note/" + messageID + "/activity",
-										Actor:   "https://" + w.config.FQDN + "/ap/acct/" + entity.ID,
-										Content: "",
-										Object:  note.Object,
-										To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
-									}
-									object = &announce
-								} else {
-									create := types.ApObject{
-										Context: []string{"https://www.w3.org/ns/activitystreams"},
-										Type:    "Create",
-										ID:      "https://" + w.config.FQDN + "/ap/note/" + messageID + "/activity",
-										Actor:   "https://" + w.config.FQDN + "/ap/acct/" + entity.ID,
-										To:      []string{"https://www.w3.org/ns/activitystreams#Public"},
-										Object:  note,
-									}
-									object = &create
+								sender = w.noteSender(ctx, entity, note)
+
+								activity := w.bridge.NoteToActivity(messageID, note, sender.ID)
+								object = &activity
+
+								err = w.store.SaveSentNote(ctx, types.ApSentNote{
+									MessageID: messageID,
+									EntityID:  sender.ID,
+									To:        bridge.Addresses(activity.To),
+									CC:        bridge.Addresses(activity.CC),
+								})
+								if err != nil {
+									log.Printf("worker/message/%v SaveSentNote %v", entity.ID, err)
 								}
 							}
 						case "delete":
@@ -204,16 +196,36 @@ func (w *Worker) StartMessageWorker() {
 									continue
 								}
 
+								// the Delete goes to the audience of the note; without a record only followers are told
+								sent, err := w.store.GetSentNote(ctx, deleteDoc.Target)
+								found := err == nil
+								if found {
+									if sent.EntityID != entity.ID {
+										character, err := w.store.GetEntityByID(ctx, sent.EntityID)
+										if err == nil {
+											sender = character
+										}
+									}
+									err = w.store.DeleteSentNote(ctx, deleteDoc.Target)
+									if err != nil {
+										log.Printf("worker/message/%v DeleteSentNote %v", entity.ID, err)
+									}
+								}
+
 								deleteObj := types.ApObject{
 									Context: "https://www.w3.org/ns/activitystreams",
 									Type:    "Delete",
 									ID:      "https://" + w.config.FQDN + "/ap/note/" + deleteDoc.Target + "/delete",
-									Actor:   "https://" + w.config.FQDN + "/ap/acct/" + entity.ID,
+									Actor:   "https://" + w.config.FQDN + "/ap/acct/" + sender.ID,
 									Object: types.ApObject{
 										Type: "Tombstone",
 										ID:   "https://" + w.config.FQDN + "/ap/note/" + deleteDoc.Target,
 									},
 								}
+								if found {
+									deleteObj.To = []string(sent.To)
+									deleteObj.CC = []string(sent.CC)
+								}
 								object = &deleteObj
 							}
 						default:
@@ -226,80 +238,49 @@ func (w *Worker) StartMessageWorker() {
 
 							additionalInboxes := make([]string, 0)
 
-							mentionPattern := regexp.MustCompile(`@(\S+@\S+)`)
-							mentions := mentionPattern.FindAllStringSubmatch(content, -1)
-							if mentions != nil {
-								for _, mention := range mentions {
-									if len(mention) != 2 {
-										continue
-									}
-
-									actorID, err := apclient.ResolveActor(ctx, mention[1])
-									if err != nil {
-										log.Printf("worker/message/%v ResolveActor %v", entity.ID, err)
-										continue
-									}
-
-									person, err := w.apclient.FetchPerson(ctx, actorID, &entity)
-									if err != nil {
-										log.Printf("worker/message/%v FetchPerson %v", entity.ID, err)
-										continue
-									}
-
-									additionalInboxes = append(additionalInboxes, person.MustGetString("inbox"))
-
-									obj, ok := object.Object.(types.ApObject)
-									if !ok {
-										log.Printf("worker/message/%v object.Object %v", entity.ID, err)
-										continue
-									}
-
-									objTags, ok := obj.Tag.([]types.Tag)
-									if !ok {
-										log.Printf("worker/message/%v obj.Tag %v", entity.ID, err)
-										continue
-									}
-
-									obj.Tag = append(objTags, types.Tag{
-										Type: "Mention",
-										Name: mention[1],
-										Href: person.MustGetString("id"),
-									})
-
-									objCCs, ok := obj.CC.([]string)
-									if !ok {
-										log.Printf("worker/message/%v obj.CC %v", entity.ID, err)
-										continue
-									}
-
-									obj.CC = append(objCCs, person.MustGetString("id"))
-
-									object.Object = obj
+							// remote actors the note addresses, i.e. mentions and the participants of a direct thread
+							for _, recipient := range w.remoteRecipients(*object) {
+								person, err := w.apclient.FetchPerson(ctx, recipient, &sender)
+								if err != nil {
+									log.Printf("worker/message/%v FetchPerson %v", entity.ID, err)
+									continue
 								}
-							}
-
-							followers, err := w.store.GetFollowers(ctx, entity.ID)
-							if err != nil {
-								log.Printf("worker/message/%v GetFollowers %v", entity.ID, err)
-								continue
+								additionalInboxes = append(additionalInboxes, person.MustGetString("inbox"))
 							}
 
 							destinations := make(map[string]bool)
 							for _, timeline := range additionalInboxes {
 								destinations[timeline] = true
 							}
-							for _, follower := range followers {
-								destinations[follower.SubscriberInbox] = true
+
+							// direct messages only reach the mentioned actors
+							if (object.Type == "Delete" && object.To == nil) || bridge.Visibility(*object) != bridge.VisibilityDirect {
+								followers, err := w.store.GetFollowers(ctx, sender.ID)
+								if err != nil {
+									log.Printf("worker/message/%v GetFollowers %v", entity.ID, err)
+									continue
+								}
+								for _, follower := range followers {
+									destinations[follower.SubscriberInbox] = true
+								}
+							}
+
+							var payload any = *object
+							signed, err := w.apclient.SignObject(ctx, *object, sender)
+							if err != nil {
+								log.Printf("worker/message/%v SignObject %v", entity.ID, err)
+							} else {
+								payload = signed
 							}
 
 							for destination := range destinations {
-								go func(ctx context.Context, destination string, object types.ApObject) {
-									err = w.apclient.PostToInbox(ctx, destination, object, entity)
+								go func(ctx context.Context, destination string, payload any) {
+									err := w.apclient.PostToInbox(ctx, destination, payload, sender)
 									if err != nil {
 										log.Printf("worker/message/%v PostToInbox %v %v", entity.ID, destination, err)
 										return
 									}
-								}(ctx, destination, *object)
+								}(ctx, destination, payload)
 							}
 						}
 					}
@@ -309,3 +290,41 @@ func (w *Worker) StartMessageWorker() {
 		}
 	}
 }
+
+// noteSender returns the entity a note is attributed to, falling back to the main entity.
+func (w *Worker) noteSender(ctx context.Context, entity types.ApEntity, note types.ApObject) types.ApEntity {
+	actor := note.AttributedTo
+	if actor == "" {
+		actor = note.Actor
+	}
+
+	id := strings.TrimPrefix(actor, "https://"+w.config.FQDN+"/ap/acct/")
+	if id == "" || id == actor || id == entity.ID {
+		return entity
+	}
+
+	character, err := w.store.GetEntityByID(ctx, id)
+	if err != nil || character.ParentID != entity.ID {
+		return entity
+	}
+
+	return character
+}
+
+// remoteRecipients returns the remote actors in the to and cc of the activity,
+// leaving out the public address and follower collections.
+func (w *Worker) remoteRecipients(object types.ApObject) []string {
+	recipients := []string{}
+	for _, field := range []any{object.To, object.CC} {
+		for _, address := range bridge.Addresses(field) {
+			if address == "https://www.w3.org/ns/activitystreams#Public" || strings.HasSuffix(address, "/followers") {
+				continue
+			}
+			if strings.HasPrefix(address, "https://"+w.config.FQDN+"/") || slices.Contains(recipients, address) {
+				continue
+			}
+			recipients = append(recipients, address)
+		}
+	}
+	return recipients
+}
@@ -0,0 +1,177 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+// profileHashTTL keeps the last seen profile around long enough to survive restarts.
+const profileHashTTL = 30 * 24 * time.Hour
+
+func profileHashKey(id string) string {
+	return "ap:profilehash:" + id
+}
+
+// profileSweepInterval is how often every profile is compared anyway.
+// Edits made on Concrnt itself raise no event here, so they are picked up by the sweep.
+const profileSweepInterval = time.Hour
+
+// profileSweepLeaseKey is held by the replica that runs the current sweep.
+const profileSweepLeaseKey = "ap:profilesweep"
+
+// StartProfileWorker delivers Update{Person} to followers when the actor of an entity changes.
+// Settings and alias changes are announced on types.ProfileChannel and handled right away.
+func (w *Worker) StartProfileWorker() {
+
+	log.Printf("start profile worker")
+
+	ctx := context.Background()
+	pubsub := w.rdb.Subscribe(ctx, types.ProfileChannel)
+	defer pubsub.Close()
+
+	changes := pubsub.Channel()
+	ticker := time.NewTicker(profileSweepInterval)
+
+	w.sweepProfiles(ctx)
+
+	for {
+		select {
+		case change := <-changes:
+			entity, err := w.store.GetEntityByCCID(ctx, change.Payload)
+			if err != nil {
+				log.Printf("worker/profile/%v GetEntityByCCID %v", change.Payload, err)
+				continue
+			}
+			w.checkProfiles(ctx, entity)
+		case <-ticker.C:
+			w.sweepProfiles(ctx)
+		}
+	}
+}
+
+// sweepProfiles compares the actors of every entity unless another replica already does.
+func (w *Worker) sweepProfiles(ctx context.Context) {
+	// the lease expires before the next tick, so that any replica may run the next sweep
+	leased, err := w.rdb.SetNX(ctx, profileSweepLeaseKey, 1, profileSweepInterval/2).Result()
+	if err != nil {
+		log.Printf("worker/profile SetNX: %v", err)
+		return
+	}
+	if !leased {
+		return
+	}
+
+	w.checkAllProfiles(ctx)
+}
+
+// checkAllProfiles compares the actors of every entity.
+func (w *Worker) checkAllProfiles(ctx context.Context) {
+	entities, err := w.store.GetAllEntities(ctx)
+	if err != nil {
+		log.Printf("worker/profile GetAllEntities: %v", err)
+		return
+	}
+
+	for _, entity := range entities {
+		if entity.CCID == "" || entity.ParentID != "" {
+			continue
+		}
+		w.checkProfiles(ctx, entity)
+	}
+}
+
+// checkProfiles compares the actors of an entity and its subprofiles.
+func (w *Worker) checkProfiles(ctx context.Context, entity types.ApEntity) {
+	w.checkProfile(ctx, entity)
+
+	subprofiles, err := w.store.GetSubprofileEntities(ctx, entity.ID)
+	if err != nil {
+		log.Printf("worker/profile/%v GetSubprofileEntities %v", entity.ID, err)
+		return
+	}
+	for _, subprofile := range subprofiles {
+		w.checkProfile(ctx, subprofile)
+	}
+}
+
+// checkProfile delivers Update{Person} when the actor of the entity differs from the last one seen.
+func (w *Worker) checkProfile(ctx context.Context, entity types.ApEntity) {
+	person, err := w.bridge.EntityToPerson(ctx, entity)
+	if err != nil {
+		log.Printf("worker/profile/%v EntityToPerson %v", entity.ID, err)
+		return
+	}
+
+	personBytes, err := json.Marshal(profileFields(person))
+	if err != nil {
+		log.Printf("worker/profile/%v json.Marshal %v", entity.ID, err)
+		return
+	}
+	sum := sha256.Sum256(personBytes)
+	hash := hex.EncodeToString(sum[:])
+
+	// swapping the hash atomically lets only one replica see a change,
+	// since every replica receives the change events
+	last, err := w.rdb.SetArgs(ctx, profileHashKey(entity.ID), hash, redis.SetArgs{TTL: profileHashTTL, Get: true}).Result()
+	if err != nil && err != redis.Nil {
+		log.Printf("worker/profile/%v SetArgs %v", entity.ID, err)
+		return
+	}
+
+	if last == hash {
+		return
+	}
+
+	// first sighting, nothing to compare against
+	if err == redis.Nil {
+		return
+	}
+
+	err = w.apclient.DeliverToFollowers(ctx, w.bridge.PersonUpdate(person), entity)
+	if err != nil {
+		log.Printf("worker/profile/%v DeliverToFollowers %v", entity.ID, err)
+		return
+	}
+
+	log.Printf("worker/profile/%v delivered profile update", entity.ID)
+}
+
+// profileFields picks the parts of the actor that come from the profile and settings.
+// Keys, media types and the like are left out so that they do not trigger updates by themselves.
+func profileFields(person types.ApObject) any {
+	var icon, image string
+	if person.Icon != nil {
+		icon = person.Icon.URL
+	}
+	if person.Image != nil {
+		image = person.Image.URL
+	}
+
+	return struct {
+		Name         string             `json:"name"`
+		Summary      string             `json:"summary"`
+		Icon         string             `json:"icon"`
+		Image        string             `json:"image"`
+		Attachment   []types.Attachment `json:"attachment"`
+		Discoverable *bool              `json:"discoverable"`
+		Indexable    *bool              `json:"indexable"`
+		AlsoKnownAs  []string           `json:"alsoKnownAs"`
+	}{
+		Name:         person.Name,
+		Summary:      person.Summary,
+		Icon:         icon,
+		Image:        image,
+		Attachment:   person.Attachment,
+		Discoverable: person.Discoverable,
+		Indexable:    person.Indexable,
+		AlsoKnownAs:  person.AlsoKnownAs,
+	}
+}
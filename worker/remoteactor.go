@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/concrnt/ccworld-ap-bridge/types"
+)
+
+const (
+	// stored actors older than this are refreshed in the background
+	remoteActorRefreshAge = 24 * time.Hour
+
+	// failed refreshes are retried after this, doubling with every failure
+	remoteActorRetryInterval = time.Hour
+
+	remoteActorBatchSize = 50
+)
+
+// StartRemoteActorWorker keeps the remote_actors table fresh and links follows and followers
+// that were recorded before they referenced it.
+func (w *Worker) StartRemoteActorWorker() {
+
+	log.Printf("start remote actor worker")
+
+	ticker := time.NewTicker(10 * time.Minute)
+	ctx := context.Background()
+
+	for ; true; <-ticker.C {
+		instanceActor, err := w.apclient.InstanceActor(ctx)
+		if err != nil {
+			log.Printf("worker/remoteactor InstanceActor: %v", err)
+			continue
+		}
+
+		// the placeholders of newly linked actors are refreshed below as stale ones
+		err = w.store.LinkRemoteActors(ctx, remoteActorBatchSize)
+		if err != nil {
+			log.Printf("worker/remoteactor LinkRemoteActors: %v", err)
+		}
+
+		stale, err := w.store.GetStaleRemoteActors(ctx, time.Now().Add(-remoteActorRefreshAge), remoteActorRetryInterval, remoteActorBatchSize)
+		if err != nil {
+			log.Printf("worker/remoteactor GetStaleRemoteActors: %v", err)
+			continue
+		}
+		for _, actor := range stale {
+			w.refreshRemoteActor(ctx, actor.ID, &instanceActor)
+		}
+	}
+}
+
+// refreshRemoteActor refetches a remote actor and records the failure for the backoff.
+func (w *Worker) refreshRemoteActor(ctx context.Context, id string, instanceActor *types.ApEntity) {
+	_, err := w.apclient.RefreshPerson(ctx, id, instanceActor)
+	if err == nil {
+		return
+	}
+	log.Printf("worker/remoteactor/%v RefreshPerson %v", id, err)
+
+	err = w.store.RecordRemoteActorFailure(ctx, id, time.Now())
+	if err != nil {
+		log.Printf("worker/remoteactor/%v RecordRemoteActorFailure %v", id, err)
+	}
+}
@@ -14,6 +14,8 @@ const (
 	ReactionAssociationSchema = "https://schema.concrnt.world/a/reaction.json"
 
 	ProfileSchema = "https://schema.concrnt.world/p/main.json"
+
+	CommunityTimelineSchema = "https://schema.concrnt.world/t/community.json"
 )
 
 const (
@@ -22,3 +24,8 @@ const (
 	UserAssocStream  = "world.concrnt.t-assoc"
 	UserApStream     = "world.concrnt.t-ap"
 )
+
+const (
+	WhisperPolicyURL   = "https://policy.concrnt.world/m/whisper.json"
+	ReadWritePolicyURL = "https://policy.concrnt.world/t/inline-read-write.json"
+)
@@ -23,6 +23,7 @@ type ProfileOverride struct {
 type MarkdownMessage struct {
 	Body            string            `json:"body"`
 	Emojis          *map[string]Emoji `json:"emojis,omitempty"`
+	Mentions        []string          `json:"mentions,omitempty"`
 	ProfileOverride *ProfileOverride  `json:"profileOverride,omitempty"`
 	Flag            string            `json:"flag,omitempty"`
 }
@@ -38,6 +39,7 @@ type Media struct {
 type MediaMessage struct {
 	Body            string            `json:"body"`
 	Emojis          *map[string]Emoji `json:"emojis,omitempty"`
+	Mentions        []string          `json:"mentions,omitempty"`
 	Medias          *[]Media          `json:"medias,omitempty"`
 	ProfileOverride *ProfileOverride  `json:"profileOverride,omitempty"`
 	Flag            string            `json:"flag,omitempty"`
@@ -53,6 +55,10 @@ type LikeAssociation struct {
 	ProfileOverride *ProfileOverride `json:"profileOverride"`
 }
 
+type MentionAssociation struct {
+	ProfileOverride *ProfileOverride `json:"profileOverride,omitempty"`
+}
+
 type CommunityTimeline struct {
 	Name        string `json:"name"`
 	Shortname   string `json:"shortname"`
@@ -72,6 +78,7 @@ type ReplyMessage struct {
 	ReplyToMessageAuthor string            `json:"replyToMessageAuthor"`
 	Body                 string            `json:"body"`
 	Emojis               *map[string]Emoji `json:"emojis"`
+	Mentions             []string          `json:"mentions,omitempty"`
 	ProfileOverride      *ProfileOverride  `json:"profileOverride"`
 	Flag                 string            `json:"flag,omitempty"`
 }
@@ -87,6 +94,7 @@ type RerouteMessage struct {
 	RerouteMessageAuthor string            `json:"rerouteMessageAuthor"`
 	Body                 string            `json:"body"`
 	Emojis               *map[string]Emoji `json:"emojis"`
+	Mentions             []string          `json:"mentions,omitempty"`
 	ProfileOverride      *ProfileOverride  `json:"profileOverride"`
 	Flag                 string            `json:"flag,omitempty"`
 }
@@ -94,3 +102,10 @@ type RerouteMessage struct {
 type WhisperPolicy struct {
 	Participants []string `json:"participants"`
 }
+
+type ReadWritePolicy struct {
+	IsWritePublic bool     `json:"isWritePublic"`
+	IsReadPublic  bool     `json:"isReadPublic"`
+	Writer        []string `json:"writer"`
+	Reader        []string `json:"reader"`
+}